@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// baseline is a set of line fingerprints from known-good captures. Filter
+// matches in it are noise the project has already accepted.
+type baseline struct {
+	names        []string
+	fingerprints map[string]bool
+}
+
+// fingerprint is a line's key in a baseline: normalized with numbers
+// masked too, so a warning still matches after the code around it moves.
+func fingerprint(s string) string {
+	return strings.TrimSpace(similarKey(s))
+}
+
+// contains reports whether every line of s, a line or a multi-line record,
+// is in the baseline.
+func (b *baseline) contains(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		if fp := fingerprint(line); fp != "" && !b.fingerprints[fp] {
+			return false
+		}
+	}
+	return true
+}
+
+func baselineDir() string {
+	return filepath.Join(configDir(), "baselines")
+}
+
+func baselinePath(name string) string {
+	return filepath.Join(baselineDir(), name+".txt")
+}
+
+// readBaseline loads the named baseline's fingerprints, one per line.
+func readBaseline(name string) (map[string]bool, error) {
+	f, err := os.Open(baselinePath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fps := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, scanBufferSize), scanBufferSize)
+	for scanner.Scan() {
+		fps[scanner.Text()] = true
+	}
+	return fps, scanner.Err()
+}
+
+// mustLoadBaseline adds the named baseline to b, which may be nil, for
+// --baseline.
+func mustLoadBaseline(b *baseline, name string) *baseline {
+	if !isValidPresetName(name) {
+		fmt.Fprintf(os.Stderr, "glance: invalid baseline name: %s\n", name)
+		os.Exit(1)
+	}
+	fps, err := readBaseline(name)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "glance: unknown baseline: %s (see glance baseline list)\n", name)
+		os.Exit(1)
+	}
+	if err != nil {
+		fatal(err.Error())
+	}
+	if b == nil {
+		b = &baseline{fingerprints: make(map[string]bool)}
+	}
+	b.names = append(b.names, name)
+	for fp := range fps {
+		b.fingerprints[fp] = true
+	}
+	return b
+}
+
+func writeBaseline(name string, fps map[string]bool) error {
+	if err := os.MkdirAll(baselineDir(), 0o755); err != nil {
+		return err
+	}
+	lines := make([]string, 0, len(fps))
+	for fp := range fps {
+		lines = append(lines, fp)
+	}
+	sort.Strings(lines)
+	f, err := os.Create(baselinePath(name))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, l := range lines {
+		w.WriteString(l + "\n")
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func doBaseline(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: glance baseline <list|add|remove>\n")
+		os.Exit(1)
+	}
+
+	sub := args[0]
+	args = args[1:]
+
+	switch sub {
+	case "list":
+		entries, _ := os.ReadDir(baselineDir())
+		found := false
+		for _, e := range entries {
+			name, ok := strings.CutSuffix(e.Name(), ".txt")
+			if !ok || e.IsDir() {
+				continue
+			}
+			fps, err := readBaseline(name)
+			if err != nil {
+				continue
+			}
+			found = true
+			fmt.Printf("  %-20s %d fingerprints\n", name, len(fps))
+		}
+		if !found {
+			fmt.Println("No baselines.")
+		}
+
+	case "add":
+		if len(args) < 2 {
+			fmt.Fprintf(os.Stderr, "Usage: glance baseline add <name> <id> [id...]\n")
+			os.Exit(1)
+		}
+		name := args[0]
+		if !isValidPresetName(name) {
+			fmt.Fprintf(os.Stderr, "glance: invalid baseline name: %s (must start with alphanumeric, use only alphanumeric/hyphens/underscores)\n", name)
+			os.Exit(1)
+		}
+		// Adding to an existing baseline widens it.
+		fps, err := readBaseline(name)
+		if os.IsNotExist(err) {
+			fps = make(map[string]bool)
+		} else if err != nil {
+			fatal(err.Error())
+		}
+		before := len(fps)
+		for _, id := range args[1:] {
+			if !validCaptureID(id) {
+				fmt.Fprintf(os.Stderr, "glance: invalid capture ID: %s\n", id)
+				os.Exit(1)
+			}
+			for _, line := range readCaptureLines(id) {
+				if fp := fingerprint(line); fp != "" {
+					fps[fp] = true
+				}
+			}
+		}
+		if err := writeBaseline(name, fps); err != nil {
+			fatal(err.Error())
+		}
+		fmt.Printf("Added baseline: %s (%d fingerprints, %d new)\n", name, len(fps), len(fps)-before)
+
+	case "remove":
+		if len(args) < 1 {
+			fmt.Fprintf(os.Stderr, "Usage: glance baseline remove <name>\n")
+			os.Exit(1)
+		}
+		name := args[0]
+		if !isValidPresetName(name) || os.Remove(baselinePath(name)) != nil {
+			fmt.Fprintf(os.Stderr, "glance: baseline not found: %s\n", name)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed baseline: %s\n", name)
+
+	default:
+		fmt.Fprintf(os.Stderr, "glance baseline: unknown subcommand: %s\n", sub)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// budgetEdge is how many matches at each end of the middle are kept before
+// the rest is sampled.
+const budgetEdge = 3
+
+// budget caps how much output pipe mode produces, in lines or in estimated
+// tokens. A zero limit means no budget.
+type budget struct {
+	limit  int
+	tokens bool
+}
+
+// parseBudget accepts "N" for lines or "Nt" for estimated tokens.
+func parseBudget(s string) (budget, error) {
+	b := budget{}
+	if strings.HasSuffix(s, "t") {
+		b.tokens = true
+		s = strings.TrimSuffix(s, "t")
+	}
+	b.limit = parsePositiveInt(s)
+	if b.limit <= 0 {
+		return budget{}, fmt.Errorf("--budget must be N (lines) or Nt (tokens)")
+	}
+	return b, nil
+}
+
+// cost is what printing a line spends of the budget. Tokens are estimated at
+// four bytes each, including the line number prefix. A multi-line record
+// (--record-start) costs what its lines do.
+func (b budget) cost(num int, text string) int {
+	lines := 1 + strings.Count(text, "\n")
+	if !b.tokens {
+		return lines
+	}
+	n := lines*(len(strconv.Itoa(num))+len(": ")) + len(text) + 1
+	return (n + 3) / 4
+}
+
+// selectGroups decides which match groups fit in limit. The first and last
+// few are preferred; the rest are sampled evenly across the remaining room.
+func selectGroups(costs []int, limit int) []bool {
+	keep := make([]bool, len(costs))
+	left := limit
+	take := func(i int) {
+		if !keep[i] && costs[i] <= left {
+			keep[i] = true
+			left -= costs[i]
+		}
+	}
+
+	total := 0
+	for _, c := range costs {
+		total += c
+	}
+	if total <= limit {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+
+	for i := 0; i < budgetEdge && i < len(costs); i++ {
+		take(i)
+		take(len(costs) - 1 - i)
+	}
+
+	var rest []int
+	restCost := 0
+	for i := budgetEdge; i < len(costs)-budgetEdge; i++ {
+		rest = append(rest, i)
+		restCost += costs[i]
+	}
+	if len(rest) == 0 || left <= 0 {
+		return keep
+	}
+	slots := left * len(rest) / restCost
+	if slots > len(rest) {
+		slots = len(rest)
+	}
+	for s := 0; s < slots; s++ {
+		take(rest[(2*s+1)*len(rest)/(2*slots)])
+	}
+	return keep
+}
+
+// budgetHold is how many budgets' worth of middle lines a budgetSampler
+// holds before thinning them, which leaves selectGroups enough to choose
+// from.
+const budgetHold = 4
+
+// matchGroup is a middle match and the context lines it pulled in.
+type matchGroup struct {
+	// seq numbers the groups in the order they started.
+	seq   int
+	lines []middleLine
+	cost  int
+}
+
+// budgetSampler holds middle lines for --budget until the input ends, in
+// bounded memory. Once they cost more than budgetHold budgets, every other
+// group between the first and last few is dropped, and from then on only
+// one in stride of the new ones is kept, doubling as often as needed.
+type budgetSampler struct {
+	b      budget
+	groups []*matchGroup
+	held   int
+	seen   int
+	stride int
+	// dropped counts the matches in groups thinned out.
+	dropped int
+}
+
+func newBudgetSampler(b budget) *budgetSampler {
+	return &budgetSampler{b: b, stride: 1}
+}
+
+func (s *budgetSampler) add(m middleLine) {
+	cost := s.b.cost(m.num, m.text)
+	s.held += cost
+	if n := len(s.groups); n > 0 && s.groups[n-1].lines[0].owner == m.owner {
+		g := s.groups[n-1]
+		g.lines = append(g.lines, m)
+		g.cost += cost
+		return
+	}
+	s.groups = append(s.groups, &matchGroup{seq: s.seen, lines: []middleLine{m}, cost: cost})
+	s.seen++
+	// The group leaving the last few is complete; keep it only on stride.
+	if i := len(s.groups) - 1 - budgetEdge; i >= 0 && !s.keeps(s.groups[i]) {
+		s.drop(i)
+	}
+	for s.held > budgetHold*s.b.limit {
+		if !s.thin() {
+			break
+		}
+	}
+}
+
+// keeps reports whether g survives thinning at the current stride.
+func (s *budgetSampler) keeps(g *matchGroup) bool {
+	return g.seq < budgetEdge || g.seq%s.stride == 0
+}
+
+func (s *budgetSampler) drop(i int) {
+	g := s.groups[i]
+	for _, m := range g.lines {
+		if m.num == m.owner {
+			s.dropped++
+		}
+	}
+	s.held -= g.cost
+	s.groups = append(s.groups[:i], s.groups[i+1:]...)
+}
+
+// thin doubles the stride and drops the groups between the first and last
+// few that are off it. It reports whether anything was dropped.
+func (s *budgetSampler) thin() bool {
+	s.stride *= 2
+	before := len(s.groups)
+	for i := len(s.groups) - 1 - budgetEdge; i >= 0; i-- {
+		if !s.keeps(s.groups[i]) {
+			s.drop(i)
+		}
+	}
+	return len(s.groups) < before
+}
+
+// finish picks the lines to print within limit. It returns them and the
+// number of matches hidden, thinned out ones included.
+func (s *budgetSampler) finish(limit int) ([]middleLine, int) {
+	var pending []middleLine
+	for _, g := range s.groups {
+		pending = append(pending, g.lines...)
+	}
+	kept, hidden := applyBudget(pending, s.b, limit)
+	return kept, hidden + s.dropped
+}
+
+// applyBudget groups pending middle lines by the match that owns them and
+// keeps the groups selectGroups picks. It returns the kept lines and the
+// number of matches dropped.
+func applyBudget(pending []middleLine, b budget, limit int) ([]middleLine, int) {
+	var starts, costs []int
+	for i, m := range pending {
+		if i == 0 || m.owner != pending[i-1].owner {
+			starts = append(starts, i)
+			costs = append(costs, 0)
+		}
+		costs[len(costs)-1] += b.cost(m.num, m.text)
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	keep := selectGroups(costs, limit)
+
+	var kept []middleLine
+	hidden := 0
+	for g, start := range starts {
+		end := len(pending)
+		if g+1 < len(starts) {
+			end = starts[g+1]
+		}
+		for _, m := range pending[start:end] {
+			if keep[g] {
+				kept = append(kept, m)
+			} else if m.num == m.owner {
+				hidden++
+			}
+		}
+	}
+	return kept, hidden
+}
+
+// shellJoin quotes args so the result can be pasted into a POSIX shell.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	for _, c := range s {
+		if !((c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.ContainsRune("-_./:=@%+,", c)) {
+			return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+		}
+	}
+	return s
+}
@@ -12,7 +12,9 @@ func doClean(args []string) {
 		if _, err := os.Stat(confPath); err == nil {
 			os.Remove(confPath)
 		}
-		fmt.Println("Purged all captures and user presets.")
+		os.Remove(normalizePath())
+		os.RemoveAll(baselineDir())
+		fmt.Println("Purged all captures, user presets, normalize rules and baselines.")
 	} else {
 		os.RemoveAll(cacheDir())
 		fmt.Println("Purged all captures.")
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultClusterSim  = 0.5
+	defaultClusterRare = 2
+	wildcard           = "<*>"
+)
+
+type clustersConfig struct {
+	id   string
+	sim  float64
+	rare int
+}
+
+func parseClustersArgs(args []string) (clustersConfig, error) {
+	if len(args) < 1 {
+		return clustersConfig{}, fmt.Errorf("usage: glance clusters <id> [--sim F] [--rare N]")
+	}
+	id := args[0]
+	args = args[1:]
+	if !validCaptureID(id) {
+		return clustersConfig{}, fmt.Errorf("invalid capture ID: %s", id)
+	}
+
+	cfg := clustersConfig{id: id, sim: defaultClusterSim, rare: defaultClusterRare}
+	i := 0
+	for i < len(args) {
+		switch args[i] {
+		case "--sim":
+			v := consumeFlag(args, &i, "--sim")
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f <= 0 || f > 1 {
+				return cfg, fmt.Errorf("--sim must be a number in (0, 1]")
+			}
+			cfg.sim = f
+		case "--rare":
+			v := consumeFlag(args, &i, "--rare")
+			n := parsePositiveInt(v)
+			if n <= 0 {
+				return cfg, fmt.Errorf("--rare must be a positive integer")
+			}
+			cfg.rare = n
+		default:
+			return cfg, fmt.Errorf("unknown flag: %s", args[i])
+		}
+	}
+	return cfg, nil
+}
+
+func doClusters(args []string) {
+	cfg, err := parseClustersArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glance clusters: %s\n", err)
+		os.Exit(1)
+	}
+	runClusters(cfg)
+}
+
+// cluster is one message shape: a template with variable tokens masked.
+type cluster struct {
+	template []string
+	count    int
+	first    int
+	last     int
+	example  string
+}
+
+// clusterer groups lines into templates, Drain style: lines are bucketed by
+// token count and first token, then joined to the most similar template in
+// the bucket or start a new one.
+type clusterer struct {
+	sim      float64
+	buckets  map[string][]*cluster
+	clusters []*cluster
+}
+
+func newClusterer(sim float64) *clusterer {
+	return &clusterer{sim: sim, buckets: make(map[string][]*cluster)}
+}
+
+// clusterTokens splits a line into tokens, masking any token with a digit
+// in it since those are nearly always variable.
+func clusterTokens(text string) []string {
+	tokens := strings.Fields(text)
+	for i, t := range tokens {
+		if strings.IndexFunc(t, unicode.IsDigit) >= 0 {
+			tokens[i] = wildcard
+		}
+	}
+	return tokens
+}
+
+// similarity is the share of positions where the template and the line
+// agree. A template wildcard only agrees with a token that was masked too.
+func similarity(template, tokens []string) float64 {
+	same := 0
+	for i, t := range template {
+		if t == tokens[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(template))
+}
+
+func (c *clusterer) add(num int, text string) {
+	tokens := clusterTokens(text)
+	if len(tokens) == 0 {
+		return
+	}
+	key := strconv.Itoa(len(tokens)) + " " + tokens[0]
+
+	var best *cluster
+	bestSim := -1.0
+	for _, cl := range c.buckets[key] {
+		if s := similarity(cl.template, tokens); s > bestSim {
+			best, bestSim = cl, s
+		}
+	}
+	if best != nil && bestSim >= c.sim {
+		for i, t := range best.template {
+			if t != tokens[i] {
+				best.template[i] = wildcard
+			}
+		}
+		best.count++
+		best.last = num
+		return
+	}
+
+	cl := &cluster{template: tokens, count: 1, first: num, last: num, example: text}
+	c.buckets[key] = append(c.buckets[key], cl)
+	c.clusters = append(c.clusters, cl)
+}
+
+// sorted returns clusters by count, most frequent first.
+func (c *clusterer) sorted() []*cluster {
+	out := append([]*cluster(nil), c.clusters...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].count != out[j].count {
+			return out[i].count > out[j].count
+		}
+		return out[i].first < out[j].first
+	})
+	return out
+}
+
+func runClusters(cfg clustersConfig) {
+	path := requireCapture(cfg.id)
+	f, err := os.Open(path)
+	if err != nil {
+		fatal(err.Error())
+	}
+	defer f.Close()
+
+	c := newClusterer(cfg.sim)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, scanBufferSize), scanBufferSize)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		c.add(lineNo, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		fatal(err.Error())
+	}
+
+	bw := bufio.NewWriter(os.Stdout)
+	rare := 0
+	fmt.Fprintf(bw, "%7s %7s %7s   %s\n", "COUNT", "FIRST", "LAST", "TEMPLATE")
+	for _, cl := range c.sorted() {
+		flag := " "
+		if cl.count <= cfg.rare {
+			flag = "!"
+			rare++
+		}
+		template := strings.Join(cl.template, " ")
+		fmt.Fprintf(bw, "%7d %7d %7d %s %s\n", cl.count, cl.first, cl.last, flag, template)
+		// The example only adds information when something was masked.
+		if strings.Contains(template, wildcard) {
+			fmt.Fprintf(bw, "%25s %d: %s\n", "", cl.first, cl.example)
+		}
+	}
+	fmt.Fprintf(bw, "--- glance clusters %s | %s | %d templates | %d rare (count <= %d, marked !) ---\n",
+		cfg.id, pluralLines(lineNo), len(c.clusters), rare, cfg.rare)
+	bw.Flush()
+}
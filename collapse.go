@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+)
+
+type collapseMode int
+
+const (
+	collapseOff collapseMode = iota
+	// collapseExact folds consecutive identical lines.
+	collapseExact
+	// collapseSimilar also folds lines differing only in numbers or hex.
+	collapseSimilar
+)
+
+// After normalizing, the counters left are runs of digits, so masking hex
+// and digits is enough to line up retry and progress spam.
+var similarMasks = []*regexp.Regexp{
+	regexp.MustCompile(`\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]{8,}\b`),
+	regexp.MustCompile(`[0-9]+`),
+}
+
+// similarKey masks the volatile parts of s so near-identical lines compare equal.
+func similarKey(s string) string {
+	s = normalize(s)
+	for _, re := range similarMasks {
+		s = re.ReplaceAllString(s, "#")
+	}
+	return s
+}
+
+// lineWriter prints numbered lines, folding runs of consecutive repeated
+// lines into one "start-end: (xN) text" line when collapsing is enabled.
+// Folded runs only cover lines that are adjacent in the input, so the
+// range always points at real lines in the capture.
+type lineWriter struct {
+	w      *bufio.Writer
+	mode   collapseMode
+	format outputFormat
+	// filters names the matching filters of lines shown by one, in JSON
+	// output.
+	filters *filterSet
+	// fields projects JSON lines before printing (--fields).
+	fields []string
+
+	start, end int
+	// raw is the line as read; text is what gets printed.
+	raw, text, key string
+	why            showReason
+	// folded counts lines hidden inside runs.
+	folded int
+
+	records []jsonLine
+	started bool
+}
+
+func newLineWriter(w *bufio.Writer, mode collapseMode, format outputFormat) *lineWriter {
+	return &lineWriter{w: w, mode: mode, format: format}
+}
+
+func (lw *lineWriter) keyOf(text string) string {
+	if lw.mode == collapseSimilar {
+		return similarKey(text)
+	}
+	return text
+}
+
+// write prints a line; why only shows up in JSON output.
+func (lw *lineWriter) write(num int, raw string, why showReason) {
+	text := project(raw, lw.fields)
+	if lw.mode == collapseOff {
+		lw.print(num, num, raw, text, why)
+		return
+	}
+	key := lw.keyOf(text)
+	if lw.end > 0 && num == lw.end+1 && key == lw.key {
+		lw.end = num
+		lw.why |= why
+		return
+	}
+	lw.flush()
+	lw.start, lw.end, lw.raw, lw.text, lw.key, lw.why = num, num, raw, text, key, why
+}
+
+// flush prints the pending run, if any.
+func (lw *lineWriter) flush() {
+	if lw.end == 0 {
+		return
+	}
+	lw.print(lw.start, lw.end, lw.raw, lw.text, lw.why)
+	lw.folded += lw.end - lw.start
+	lw.start, lw.end = 0, 0
+}
+
+// print writes lines start to end, all represented by text, which is raw
+// after projection.
+func (lw *lineWriter) print(start, end int, raw, text string, why showReason) {
+	count := end - start + 1
+	if lw.format == formatText {
+		if count == 1 {
+			fmt.Fprintf(lw.w, "%d: %s\n", start, text)
+		} else {
+			fmt.Fprintf(lw.w, "%d-%d: (x%d) %s\n", start, end, count, text)
+		}
+		return
+	}
+	l := jsonLine{N: start, Text: text, Reasons: why.names()}
+	if count > 1 {
+		l.End, l.Count = end, count
+	}
+	if why&reasonFilter != 0 && lw.filters != nil {
+		l.Filters = lw.filters.matching(raw)
+	}
+	lw.record(l)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// diagGCC is file:line[:col]: [severity:] message, as written by go
+	// build, go vet, gcc, clang and eslint -f unix. The file must have an
+	// extension so timestamps and URLs aren't taken for one.
+	diagGCC = regexp.MustCompile(`^((?:[A-Za-z]:)?[^\s:()]+\.[A-Za-z0-9]+):(\d+)(?::(\d+))?:\s+(?:(fatal error|error|warning|note|info)(?:\[[^\]]*\])?:\s*)?(.+)$`)
+	// diagESLintUnix is the [Error/rule] suffix of eslint -f unix.
+	diagESLintUnix = regexp.MustCompile(`\s*\[(Error|Warning)(/[^\]]*)?\]$`)
+	// diagTSC is tsc's file(line,col): error TS1234: message, or the
+	// file:line:col - error TS1234: form of tsc --pretty false.
+	diagTSC = regexp.MustCompile(`^(\S+?)(?:\((\d+),(\d+)\):|:(\d+):(\d+) -) (error|warning|message) (TS\d+: .+)$`)
+	// diagRustHeader and diagRustLocation are rustc's two-line form:
+	//	error[E0425]: cannot find value `x` in this scope
+	//	 --> src/main.rs:2:5
+	diagRustHeader   = regexp.MustCompile(`^(error|warning)(\[\w+\])?: (.+)$`)
+	diagRustLocation = regexp.MustCompile(`^\s*--> (\S+?):(\d+):(\d+)$`)
+	// diagESLintFile and diagESLintEntry are eslint's default stylish
+	// format: a path on its own line, then indented line:col entries.
+	diagESLintFile  = regexp.MustCompile(`^(?:[A-Za-z]:)?[^\s:]+\.[A-Za-z0-9]+$`)
+	diagESLintEntry = regexp.MustCompile(`^\s+(\d+):(\d+)\s+(error|warning)\s+(.+)$`)
+)
+
+// diagSeverities orders severities in counts and the footer.
+var diagSeverities = []string{"error", "warning", "note"}
+
+// diagnostic is one compiler or linter message. num is the capture line
+// it was first seen on and count how many times it appeared.
+type diagnostic struct {
+	num      int
+	file     string
+	pos      string
+	severity string
+	message  string
+	count    int
+}
+
+// diagSummarizer groups file:line diagnostics by file, dropping repeats.
+type diagSummarizer struct {
+	diags []*diagnostic
+	seen  map[string]*diagnostic
+	// rust holds a rustc header waiting for its --> location line.
+	rust *diagnostic
+	// eslintFile is the file heading the current eslint stylish block.
+	eslintFile string
+}
+
+func newDiagSummarizer() *diagSummarizer {
+	return &diagSummarizer{seen: make(map[string]*diagnostic)}
+}
+
+func (s *diagSummarizer) add(num int, text string) {
+	if m := diagRustLocation.FindStringSubmatch(text); m != nil {
+		if s.rust != nil {
+			s.rust.file = m[1]
+			s.rust.pos = m[2] + ":" + m[3]
+			s.record(s.rust)
+			s.rust = nil
+		}
+		return
+	}
+	if m := diagRustHeader.FindStringSubmatch(text); m != nil {
+		s.rust = &diagnostic{num: num, severity: m[1], message: m[3]}
+		if m[2] != "" {
+			s.rust.message = strings.Trim(m[2], "[]") + ": " + m[3]
+		}
+		return
+	}
+	if m := diagTSC.FindStringSubmatch(text); m != nil {
+		pos := m[2] + ":" + m[3]
+		if m[2] == "" {
+			pos = m[4] + ":" + m[5]
+		}
+		s.record(&diagnostic{num: num, file: m[1], pos: pos, severity: m[6], message: m[7]})
+		return
+	}
+	if m := diagGCC.FindStringSubmatch(text); m != nil {
+		pos := m[2]
+		if m[3] != "" {
+			pos += ":" + m[3]
+		}
+		d := &diagnostic{num: num, file: m[1], pos: pos, severity: m[4], message: m[5]}
+		if d.severity == "" {
+			// go build and go vet don't say; eslint -f unix says at the end.
+			d.severity = "error"
+			if u := diagESLintUnix.FindStringSubmatch(d.message); u != nil {
+				d.severity = strings.ToLower(u[1])
+				d.message = strings.TrimSuffix(d.message, u[0])
+				if u[2] != "" {
+					d.message += "  " + u[2][1:]
+				}
+			}
+		}
+		s.record(d)
+		return
+	}
+	if s.eslintFile != "" {
+		if m := diagESLintEntry.FindStringSubmatch(text); m != nil {
+			s.record(&diagnostic{num: num, file: s.eslintFile, pos: m[1] + ":" + m[2], severity: m[3], message: m[4]})
+			return
+		}
+	}
+	s.eslintFile = ""
+	if diagESLintFile.MatchString(text) {
+		s.eslintFile = text
+	}
+}
+
+// record adds d unless the same diagnostic was already seen, in which case
+// it counts the repeat.
+func (s *diagSummarizer) record(d *diagnostic) {
+	d.file = strings.TrimPrefix(d.file, "./")
+	d.severity = normalizeSeverity(d.severity)
+	key := strings.Join([]string{d.file, d.pos, d.severity, d.message}, "\x00")
+	if prev := s.seen[key]; prev != nil {
+		prev.count++
+		return
+	}
+	d.count = 1
+	s.seen[key] = d
+	s.diags = append(s.diags, d)
+}
+
+func normalizeSeverity(s string) string {
+	switch strings.ToLower(s) {
+	case "fatal error", "error":
+		return "error"
+	case "warning":
+		return "warning"
+	}
+	return "note"
+}
+
+func (s *diagSummarizer) report() *summaryReport {
+	rep := &summaryReport{Name: "diagnostics", Counts: make(map[string]int), Items: []summaryItem{}}
+	var files []string
+	byFile := make(map[string][]*diagnostic)
+	duplicates := 0
+	for _, d := range s.diags {
+		if byFile[d.file] == nil {
+			files = append(files, d.file)
+		}
+		byFile[d.file] = append(byFile[d.file], d)
+		rep.Counts[d.severity]++
+		duplicates += d.count - 1
+	}
+	for _, file := range files {
+		diags := byFile[file]
+		it := summaryItem{Kind: "file", Counts: make(map[string]int)}
+		posWidth, sevWidth := 0, 0
+		for _, d := range diags {
+			it.Counts[d.severity]++
+			posWidth = max(posWidth, len(d.pos))
+			sevWidth = max(sevWidth, len(d.severity))
+		}
+		for _, d := range diags {
+			row := fmt.Sprintf("%-*s  %-*s  %s", posWidth, d.pos, sevWidth, d.severity, d.message)
+			if d.count > 1 {
+				row += fmt.Sprintf(" (x%d)", d.count)
+			}
+			it.addLine(d.num, row)
+		}
+		it.Title = file + " (" + strings.Join(severityCounts(it.Counts), ", ") + ")"
+		rep.Items = append(rep.Items, it)
+	}
+
+	if len(s.diags) == 0 {
+		rep.segments = []string{"no diagnostics found"}
+		return rep
+	}
+	rep.Counts["files"] = len(files)
+	rep.Counts["duplicates"] = duplicates
+	seg := "diagnostics: " + strings.Join(severityCounts(rep.Counts), ", ") + " in " + plural(len(files), "file")
+	if duplicates > 0 {
+		seg += ", " + plural(duplicates, "repeat") + " dropped"
+	}
+	rep.segments = []string{seg}
+	return rep
+}
+
+// severityCounts renders counts like "2 errors", "1 warning", skipping
+// severities with none.
+func severityCounts(counts map[string]int) []string {
+	var parts []string
+	for _, sev := range diagSeverities {
+		if n := counts[sev]; n > 0 {
+			parts = append(parts, plural(n, sev))
+		}
+	}
+	return parts
+}
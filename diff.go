@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+type diffConfig struct {
+	ids [2]string
+	// exact compares lines as they are, without masking volatile tokens.
+	exact bool
+	// stat prints only the counts and hunk ranges.
+	stat bool
+}
+
+func parseDiffArgs(args []string) (diffConfig, error) {
+	if len(args) < 2 {
+		return diffConfig{}, fmt.Errorf("usage: glance diff <id1> <id2> [--exact] [--stat]")
+	}
+	cfg := diffConfig{ids: [2]string{args[0], args[1]}}
+	for _, id := range cfg.ids {
+		if !validCaptureID(id) {
+			return cfg, fmt.Errorf("invalid capture ID: %s", id)
+		}
+	}
+	args = args[2:]
+	for _, a := range args {
+		switch a {
+		case "--exact":
+			cfg.exact = true
+		case "--stat":
+			cfg.stat = true
+		default:
+			return cfg, fmt.Errorf("unknown flag: %s", a)
+		}
+	}
+	return cfg, nil
+}
+
+func doDiff(args []string) {
+	cfg, err := parseDiffArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glance diff: %s\n", err)
+		os.Exit(1)
+	}
+	runDiff(cfg)
+}
+
+// diffHunk is a run of changes: lines A to AEnd of the first capture
+// replaced by B to BEnd of the second. An empty side has End < its start.
+type diffHunk struct {
+	A    int `json:"a"`
+	AEnd int `json:"a_end"`
+	B    int `json:"b"`
+	BEnd int `json:"b_end"`
+}
+
+func (h diffHunk) String() string {
+	side := func(sign string, from, to int) string {
+		switch {
+		case to < from:
+			return ""
+		case to == from:
+			return fmt.Sprintf("%s%d", sign, from)
+		}
+		return fmt.Sprintf("%s%d-%d", sign, from, to)
+	}
+	return strings.TrimSpace(side("-", h.A, h.AEnd) + " " + side("+", h.B, h.BEnd))
+}
+
+// maxDiffCost bounds the edit distance middleSnake searches before it
+// settles for a split that may not be optimal, so very different captures
+// still diff in reasonable time.
+const maxDiffCost = 1024
+
+// diffLines compares two sequences and marks the lines of each that are
+// not in a common subsequence: removed from a, added in b. The subsequence
+// is the longest one unless the inputs are very different.
+func diffLines(a, b []string) (removed, added []bool) {
+	// Comparing ints is cheaper than strings in the inner loop.
+	ids := make(map[string]int)
+	var inA, inB []bool
+	key := func(lines []string, seen *[]bool) []int {
+		out := make([]int, len(lines))
+		for i, l := range lines {
+			id, ok := ids[l]
+			if !ok {
+				id = len(ids)
+				ids[l] = id
+				inA, inB = append(inA, false), append(inB, false)
+			}
+			(*seen)[id] = true
+			out[i] = id
+		}
+		return out
+	}
+	ka, kb := key(a, &inA), key(b, &inB)
+
+	// A line only one side has is a change whatever the diff, so it is
+	// left out of the search.
+	removed, added = make([]bool, len(a)), make([]bool, len(b))
+	keep := func(keys []int, other []bool, changed []bool) (kept, index []int) {
+		for i, k := range keys {
+			if other[k] {
+				kept = append(kept, k)
+				index = append(index, i)
+			} else {
+				changed[i] = true
+			}
+		}
+		return kept, index
+	}
+	ka, ia := keep(ka, inB, removed)
+	kb, ib := keep(kb, inA, added)
+
+	d := &differ{a: ka, b: kb, removed: make([]bool, len(ka)), added: make([]bool, len(kb))}
+	size := 2*((len(ka)+len(kb)+1)/2+1) + 1
+	d.vf, d.vb = make([]int, size), make([]int, size)
+	d.compare(0, len(ka), 0, len(kb))
+	for i, r := range d.removed {
+		removed[ia[i]] = r
+	}
+	for i, r := range d.added {
+		added[ib[i]] = r
+	}
+	return removed, added
+}
+
+// differ is Myers' linear space diff: find the middle snake of the
+// shortest edit script, then recurse on each side of it.
+type differ struct {
+	a, b           []int
+	removed, added []bool
+	// vf[k] is how far along a the furthest forward path on diagonal
+	// k = x-y reached; vb the same for the reversed sequences. They are
+	// shared by every call, which only reads what it wrote first.
+	vf, vb []int
+}
+
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	switch {
+	case aLo == aHi:
+		for i := bLo; i < bHi; i++ {
+			d.added[i] = true
+		}
+		return
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.removed[i] = true
+		}
+		return
+	}
+	x, y := d.middleSnake(aLo, aHi, bLo, bHi)
+	d.compare(aLo, x, bLo, y)
+	d.compare(x, aHi, y, bHi)
+}
+
+// middleSnake returns a point on the shortest edit script for
+// a[aLo:aHi] and b[bLo:bHi] that splits it into two smaller ones. Both
+// sides must be non-empty and differ in their first and last lines.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	limit := (n + m + 1) / 2
+	off := limit + 1
+	vf, vb := d.vf, d.vb
+	vf[off+1], vb[off+1] = 0, 0
+	for e := 0; e <= limit; e++ {
+		if e > maxDiffCost {
+			return d.furthest(aLo, bLo, n, m, e-1, off)
+		}
+		for k := -e; k <= e; k += 2 {
+			var x int
+			if k == -e || (k != e && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if delta%2 != 0 && delta-k >= -(e-1) && delta-k <= e-1 && x+vb[off+delta-k] >= n {
+				return aLo + x, bLo + y
+			}
+		}
+		for k := -e; k <= e; k += 2 {
+			var x int
+			if k == -e || (k != e && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			if delta%2 == 0 && delta-k >= -e && delta-k <= e && x+vf[off+delta-k] >= n {
+				return aHi - x, bHi - y
+			}
+		}
+	}
+	// Unreachable: the paths meet by the time they cover half the edits.
+	return aLo, bLo
+}
+
+// furthest gives up on the middle snake and splits where the forward
+// paths of cost e got furthest, as GNU diff does when a diff is too
+// expensive.
+func (d *differ) furthest(aLo, bLo, n, m, e, off int) (int, int) {
+	bestX, bestY := 0, 0
+	for k := -e; k <= e; k += 2 {
+		x := min(d.vf[off+k], n)
+		y := x - k
+		if y < 0 || y > m {
+			continue
+		}
+		if x+y > bestX+bestY {
+			bestX, bestY = x, y
+		}
+	}
+	if bestX+bestY == 0 || (bestX == n && bestY == m) {
+		bestX, bestY = n/2, m/2
+	}
+	return aLo + bestX, bLo + bestY
+}
+
+// diffHunks groups the changed lines into hunks, with 1-based line numbers.
+func diffHunks(removed, added []bool) []diffHunk {
+	var hunks []diffHunk
+	i, j := 0, 0
+	for i < len(removed) || j < len(added) {
+		if (i < len(removed) && removed[i]) || (j < len(added) && added[j]) {
+			h := diffHunk{A: i + 1, B: j + 1}
+			for i < len(removed) && removed[i] {
+				i++
+			}
+			for j < len(added) && added[j] {
+				j++
+			}
+			h.AEnd, h.BEnd = i, j
+			hunks = append(hunks, h)
+			continue
+		}
+		i++
+		j++
+	}
+	return hunks
+}
+
+// readCaptureLines loads a stored capture.
+func readCaptureLines(id string) []string {
+	f, err := os.Open(requireCapture(id))
+	if err != nil {
+		fatal(err.Error())
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, scanBufferSize), scanBufferSize)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		fatal(err.Error())
+	}
+	return lines
+}
+
+// captureDiff is the comparison of two captures.
+type captureDiff struct {
+	a, b           []string
+	hunks          []diffHunk
+	removed, added int
+	exact          bool
+}
+
+func diffCaptures(id1, id2 string, exact bool) captureDiff {
+	d := captureDiff{a: readCaptureLines(id1), b: readCaptureLines(id2), exact: exact}
+	keys := func(lines []string) []string {
+		if exact {
+			return lines
+		}
+		out := make([]string, len(lines))
+		for i, l := range lines {
+			out[i] = normalize(l)
+		}
+		return out
+	}
+	d.hunks = diffHunks(diffLines(keys(d.a), keys(d.b)))
+	for _, h := range d.hunks {
+		d.removed += h.AEnd - h.A + 1
+		d.added += h.BEnd - h.B + 1
+	}
+	return d
+}
+
+// write prints the removed and added lines, hunk by hunk, stopping after
+// limit lines if limit is positive. It returns how many it printed.
+func (d captureDiff) write(w *bufio.Writer, limit int) int {
+	n := 0
+	line := func(sign string, num int, text string) {
+		if limit <= 0 || n < limit {
+			fmt.Fprintf(w, "%s%d: %s\n", sign, num, text)
+			n++
+		}
+	}
+	for _, h := range d.hunks {
+		for num := h.A; num <= h.AEnd; num++ {
+			line("-", num, d.a[num-1])
+		}
+		for num := h.B; num <= h.BEnd; num++ {
+			line("+", num, d.b[num-1])
+		}
+	}
+	return n
+}
+
+// footer returns the footer segments for the changes, listing the hunks
+// if ranges is set.
+func (d captureDiff) footer(ranges bool) []string {
+	if len(d.hunks) == 0 {
+		return d.masked([]string{"no changes"})
+	}
+	changes := fmt.Sprintf("-%d +%d in %s", d.removed, d.added, plural(len(d.hunks), "hunk"))
+	if ranges {
+		parts := make([]string, len(d.hunks))
+		for i, h := range d.hunks {
+			parts[i] = h.String()
+		}
+		changes += ": " + strings.Join(parts, ", ")
+	}
+	return d.masked([]string{changes})
+}
+
+func (d captureDiff) masked(parts []string) []string {
+	if d.exact {
+		return parts
+	}
+	return append(parts, "volatile tokens ignored")
+}
+
+func runDiff(cfg diffConfig) {
+	d := diffCaptures(cfg.ids[0], cfg.ids[1], cfg.exact)
+	bw := bufio.NewWriter(os.Stdout)
+	if !cfg.stat {
+		d.write(bw, 0)
+	}
+	parts := append([]string{"glance diff " + cfg.ids[0] + " " + cfg.ids[1],
+		pluralLines(len(d.a)) + " vs " + pluralLines(len(d.b))}, d.footer(cfg.stat)...)
+	fmt.Fprintf(bw, "--- %s ---\n", strings.Join(parts, " | "))
+	bw.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// entry is a multi-line log record: a line matching --record-start and
+// the lines after it up to the next one.
+type entry struct {
+	first, last int
+	// text is the record's lines joined with newlines, so filters match
+	// anywhere in it.
+	text string
+}
+
+// lines splits the record back into its lines.
+func (e entry) lines() []string {
+	return strings.Split(e.text, "\n")
+}
+
+// entryGrouper assembles lines into records. Lines before the first start
+// line form a record of their own.
+type entryGrouper struct {
+	start *regexp.Regexp
+	cur   entry
+	lines []string
+}
+
+func newEntryGrouper(start *regexp.Regexp) *entryGrouper {
+	return &entryGrouper{start: start}
+}
+
+// push takes the next line and returns the record it completes, if any.
+func (g *entryGrouper) push(num int, text string) (entry, bool) {
+	if g.lines != nil && !g.start.MatchString(text) {
+		g.lines = append(g.lines, text)
+		g.cur.last = num
+		return entry{}, false
+	}
+	e, ok := g.flush()
+	g.cur = entry{first: num, last: num}
+	g.lines = []string{text}
+	return e, ok
+}
+
+// flush returns the record in progress at the end of the input.
+func (g *entryGrouper) flush() (entry, bool) {
+	if g.lines == nil {
+		return entry{}, false
+	}
+	e := g.cur
+	e.text = strings.Join(g.lines, "\n")
+	g.lines = nil
+	return e, true
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// filterMode changes how a -f or -x pattern is interpreted.
+type filterMode int
+
+const (
+	// modeFixed treats the pattern as a literal string (-F).
+	modeFixed filterMode = 1 << iota
+	// modeWord only matches whole words (-w).
+	modeWord
+	// modeIcase ignores case (-i).
+	modeIcase
+)
+
+// parseModeLetters reads the F, w and i letters used by -F/-w/-i and by
+// per-filter forms like -fFi.
+func parseModeLetters(s string) (filterMode, bool) {
+	var m filterMode
+	for _, c := range s {
+		switch c {
+		case 'F':
+			m |= modeFixed
+		case 'w':
+			m |= modeWord
+		case 'i':
+			m |= modeIcase
+		default:
+			return 0, false
+		}
+	}
+	return m, s != ""
+}
+
+// modeRegex returns the regex source for pattern under mode.
+func modeRegex(pattern string, mode filterMode) string {
+	if mode&modeFixed != 0 {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if mode&modeWord != 0 {
+		pattern = `(?:^|\W)(?:` + pattern + `)(?:\W|$)`
+	}
+	if mode&modeIcase != 0 {
+		pattern = "(?i)" + pattern
+	}
+	return pattern
+}
+
+// filterSpec is one include filter as given on the command line: a -f
+// pattern, or a preset with the exclusions it carries.
+type filterSpec struct {
+	preset  string
+	pattern string
+	exclude string
+	mode    filterMode
+}
+
+// name identifies the filter in output: the preset name, or the pattern.
+func (s filterSpec) name() string {
+	if s.preset != "" {
+		return s.preset
+	}
+	return s.pattern
+}
+
+// matchFlags collects the filter flags shared by pipe mode and show.
+type matchFlags struct {
+	filters  []filterSpec
+	queries  []string
+	excludes []string
+	// where holds --where conditions on JSON lines, which must all hold.
+	where []string
+	// mode applies to every -f and -x pattern (-F, -w, -i).
+	mode filterMode
+	// baseline holds the lines of --baseline, which don't count as matches.
+	baseline *baseline
+	// args are the flags as given, for suggesting an equivalent command.
+	args []string
+}
+
+// selects reports whether any include filter was given.
+func (m matchFlags) selects() bool {
+	return len(m.filters) > 0 || len(m.queries) > 0 || len(m.where) > 0
+}
+
+// matcher reports whether a line is of interest.
+type matcher interface {
+	match(s string) bool
+}
+
+// regexMatcher matches include unless exclude matches too.
+type regexMatcher struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func (m regexMatcher) match(s string) bool {
+	if !m.include.MatchString(s) {
+		return false
+	}
+	return m.exclude == nil || !m.exclude.MatchString(s)
+}
+
+// compileSpec compiles a -f pattern or preset into a regexMatcher.
+func compileSpec(spec filterSpec) (regexMatcher, error) {
+	var m regexMatcher
+	var err error
+	if m.include, err = compileRegex(modeRegex(spec.pattern, spec.mode)); err != nil {
+		return m, err
+	}
+	if spec.exclude != "" {
+		if m.exclude, err = compileRegex(spec.exclude); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
+
+// filter is a compiled include filter with the name it is reported under.
+type filter struct {
+	name string
+	matcher
+}
+
+// filterSet is the compiled form of matchFlags. Include filters OR
+// together; exclusions are applied afterwards and veto any match. --where
+// conditions narrow the matches of the other filters, or select lines by
+// themselves when there are none.
+type filterSet struct {
+	// names lists every include filter in command line order.
+	names    []string
+	includes []filter
+	// literals holds fixed-string filters when there are enough of them
+	// to be worth matching together.
+	literals *literalSet
+	excludes []*regexp.Regexp
+	where    matcher
+	baseline *baseline
+	// suppressed counts matches vetoed by the baseline.
+	suppressed int
+}
+
+func compileRegex(s string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %s: %w", s, err)
+	}
+	return re, nil
+}
+
+func compileMatch(m matchFlags) (*filterSet, error) {
+	fs := &filterSet{baseline: m.baseline}
+	specs := make([]filterSpec, len(m.filters))
+	var literals []literalPattern
+	for i, spec := range m.filters {
+		if spec.preset == "" {
+			spec.mode |= m.mode
+		}
+		specs[i] = spec
+		fs.names = append(fs.names, spec.name())
+		if isLiteralSpec(spec) {
+			literals = append(literals, literalPattern{
+				name:  spec.name(),
+				text:  spec.pattern,
+				icase: spec.mode&modeIcase != 0,
+				word:  spec.mode&modeWord != 0,
+			})
+		}
+	}
+	if len(literals) >= literalSetMin {
+		fs.literals = newLiteralSet(literals)
+	}
+
+	for _, spec := range specs {
+		if fs.literals != nil && isLiteralSpec(spec) {
+			continue
+		}
+		rm, err := compileSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		fs.includes = append(fs.includes, filter{name: spec.name(), matcher: rm})
+	}
+	for _, q := range m.queries {
+		qm, err := parseQuery(q)
+		if err != nil {
+			return nil, err
+		}
+		fs.names = append(fs.names, q)
+		fs.includes = append(fs.includes, filter{name: q, matcher: qm})
+	}
+	for _, x := range m.excludes {
+		re, err := compileRegex(modeRegex(x, m.mode))
+		if err != nil {
+			return nil, err
+		}
+		fs.excludes = append(fs.excludes, re)
+	}
+	if len(m.where) > 0 {
+		wm, err := compileWhere(m.where)
+		if err != nil {
+			return nil, err
+		}
+		if len(fs.names) == 0 {
+			name := strings.Join(m.where, ", ")
+			fs.names = append(fs.names, name)
+			fs.includes = append(fs.includes, filter{name: name, matcher: wm})
+		} else {
+			fs.where = wm
+		}
+	}
+	return fs, nil
+}
+
+// isLiteralSpec reports whether spec can go in a literalSet. Non-ASCII
+// case-insensitive literals stay regexes so Unicode folding still works.
+func isLiteralSpec(spec filterSpec) bool {
+	if spec.mode&modeFixed == 0 || spec.pattern == "" {
+		return false
+	}
+	return spec.mode&modeIcase == 0 || isASCII(spec.pattern)
+}
+
+// allowed reports whether a matched line survives exclusions and --where.
+func (fs *filterSet) allowed(s string) bool {
+	for _, re := range fs.excludes {
+		if re.MatchString(s) {
+			return false
+		}
+	}
+	return fs.where == nil || fs.where.match(s)
+}
+
+// matching returns the names of the include filters matching s, or nil if
+// none do or an exclusion or the baseline vetoes the line.
+func (fs *filterSet) matching(s string) []string {
+	var names []string
+	if fs.literals != nil {
+		fs.literals.each(s, func(i int) bool {
+			names = append(names, fs.literals.patterns[i].name)
+			return true
+		})
+	}
+	for _, f := range fs.includes {
+		if f.match(s) {
+			names = append(names, f.name)
+		}
+	}
+	if names == nil || !fs.allowed(s) {
+		return nil
+	}
+	if fs.baseline != nil && fs.baseline.contains(s) {
+		fs.suppressed++
+		return nil
+	}
+	return names
+}
+
+// filterStat counts the lines one include filter matched.
+type filterStat struct {
+	name        string
+	count       int
+	first, last int
+}
+
+// filterStats tracks every include filter of a filterSet, in command line
+// order, over all lines read, whether or not they end up printed.
+type filterStats struct {
+	stats []filterStat
+	index map[string]int
+	// fs reports the lines its baseline suppressed.
+	fs *filterSet
+}
+
+func newFilterStats(fs *filterSet) *filterStats {
+	st := &filterStats{index: make(map[string]int), fs: fs}
+	for _, name := range fs.names {
+		if _, ok := st.index[name]; ok {
+			continue
+		}
+		st.index[name] = len(st.stats)
+		st.stats = append(st.stats, filterStat{name: name})
+	}
+	return st
+}
+
+// add records that line num matched the named filters.
+func (st *filterStats) add(num int, names []string) {
+	for _, name := range names {
+		s := &st.stats[st.index[name]]
+		if s.last == num {
+			// The same filter given twice
+			continue
+		}
+		if s.count == 0 {
+			s.first = num
+		}
+		s.count++
+		s.last = num
+	}
+}
+
+// footer returns one segment per filter, like "errors: 41 (first 101,
+// last 2990)".
+func (st *filterStats) footer() []string {
+	var parts []string
+	for _, s := range st.stats {
+		switch s.count {
+		case 0:
+			parts = append(parts, s.name+": 0")
+		case 1:
+			parts = append(parts, fmt.Sprintf("%s: 1 (line %d)", s.name, s.first))
+		default:
+			parts = append(parts, fmt.Sprintf("%s: %d (first %d, last %d)", s.name, s.count, s.first, s.last))
+		}
+	}
+	if b := st.fs.baseline; b != nil {
+		parts = append(parts, fmt.Sprintf("baseline %s: %d suppressed", strings.Join(b.names, ", "), st.fs.suppressed))
+	}
+	return parts
+}
+
+// suppressed is the number of matches the baseline suppressed.
+func (st *filterStats) suppressed() int {
+	return st.fs.suppressed
+}
+
+func (st *filterStats) json() []jsonFilterStat {
+	var out []jsonFilterStat
+	for _, s := range st.stats {
+		out = append(out, jsonFilterStat{Name: s.name, Count: s.count, First: s.first, Last: s.last})
+	}
+	return out
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 // consumeFlag checks that args[i+1] exists and returns it, advancing i by 2.
@@ -17,23 +18,81 @@ func consumeFlag(args []string, i *int, name string) string {
 	return v
 }
 
-// parseFilters handles -f/--filter and -p/--preset flags, appending to filters.
+// parseFilter handles -f/--filter, -p/--preset, -q/--query, -x/--exclude,
+// -X/--exclude-preset, --where and the -F/-w/-i modes, recording them in m. Modes
+// can also be given for a single filter as -fF, -fw, -fi or combinations.
 // Returns true if the flag was consumed, false otherwise.
-func parseFilter(args []string, i *int, filters *[]string) bool {
-	switch args[*i] {
+func parseFilter(args []string, i *int, m *matchFlags) bool {
+	start := *i
+	a := args[*i]
+	if len(a) > 2 && strings.HasPrefix(a, "-f") {
+		if mode, ok := parseModeLetters(a[2:]); ok {
+			v := consumeFlag(args, i, a)
+			m.filters = append(m.filters, filterSpec{pattern: v, mode: mode})
+			m.args = append(m.args, args[start:*i]...)
+			return true
+		}
+	}
+	switch a {
+	case "-F", "--fixed-strings":
+		m.mode |= modeFixed
+		*i++
+	case "-w", "--word":
+		m.mode |= modeWord
+		*i++
+	case "-i", "--ignore-case":
+		m.mode |= modeIcase
+		*i++
 	case "-f", "--filter":
 		v := consumeFlag(args, i, "-f")
-		*filters = append(*filters, v)
-		return true
+		m.filters = append(m.filters, filterSpec{pattern: v})
 	case "-p", "--preset":
 		v := consumeFlag(args, i, "-p")
-		regex, err := resolvePreset(v)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
-		*filters = append(*filters, regex)
-		return true
+		p := mustResolvePreset(v)
+		m.filters = append(m.filters, filterSpec{preset: p.name, pattern: p.regex, exclude: p.exclude})
+	case "-q", "--query":
+		v := consumeFlag(args, i, "-q")
+		m.queries = append(m.queries, v)
+	case "-x", "--exclude":
+		v := consumeFlag(args, i, "-x")
+		m.excludes = append(m.excludes, v)
+	case "-X", "--exclude-preset":
+		v := consumeFlag(args, i, "-X")
+		p := mustResolvePreset(v)
+		m.excludes = append(m.excludes, p.regex)
+	case "--where":
+		v := consumeFlag(args, i, "--where")
+		m.where = append(m.where, v)
+	case "--baseline":
+		v := consumeFlag(args, i, "--baseline")
+		m.baseline = mustLoadBaseline(m.baseline, v)
+	default:
+		return false
+	}
+	m.args = append(m.args, args[start:*i]...)
+	return true
+}
+
+func mustResolvePreset(name string) preset {
+	p, err := resolvePreset(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return p
+}
+
+// parseCollapse handles --collapse and --collapse-similar.
+// Returns true if the flag was consumed, false otherwise.
+func parseCollapse(args []string, i *int, mode *collapseMode) bool {
+	switch args[*i] {
+	case "--collapse":
+		*mode = collapseExact
+	case "--collapse-similar":
+		*mode = collapseSimilar
+	default:
+		return false
 	}
-	return false
+	*i++
+	return true
 }
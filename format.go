@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 func formatAge(secs int64) string {
@@ -21,6 +22,14 @@ func formatAge(secs int64) string {
 	return fmt.Sprintf("%dd ago", secs/86400)
 }
 
+// formatDuration rounds d to a readable precision for the footer.
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
 func pluralLines(n int) string {
 	if n == 1 {
 		return "1 line"
@@ -28,31 +37,42 @@ func pluralLines(n int) string {
 	return fmt.Sprintf("%d lines", n)
 }
 
-// sectionRanges takes sorted line numbers and returns a string like "1-5, 10, 20-25"
-func sectionRanges(nums []int) string {
-	if len(nums) == 0 {
-		return ""
+// plural counts n of something named by a regular noun: "1 error",
+// "3 errors", "2 matches". The noun may be a phrase ending in it.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
 	}
-	var parts []string
-	start := nums[0]
-	prev := nums[0]
-	for i := 1; i < len(nums); i++ {
-		if nums[i] == prev+1 {
-			prev = nums[i]
+	for _, end := range []string{"s", "x", "ch", "sh"} {
+		if strings.HasSuffix(noun, end) {
+			return fmt.Sprintf("%d %ses", n, noun)
+		}
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// sectionSpans groups sorted line numbers into runs of consecutive lines.
+func sectionSpans(nums []int) [][2]int {
+	var spans [][2]int
+	for _, n := range nums {
+		if len(spans) > 0 && spans[len(spans)-1][1]+1 == n {
+			spans[len(spans)-1][1] = n
 			continue
 		}
-		if start == prev {
-			parts = append(parts, fmt.Sprintf("%d", start))
+		spans = append(spans, [2]int{n, n})
+	}
+	return spans
+}
+
+// sectionRanges takes sorted line numbers and returns a string like "1-5, 10, 20-25"
+func sectionRanges(nums []int) string {
+	var parts []string
+	for _, s := range sectionSpans(nums) {
+		if s[0] == s[1] {
+			parts = append(parts, fmt.Sprintf("%d", s[0]))
 		} else {
-			parts = append(parts, fmt.Sprintf("%d-%d", start, prev))
+			parts = append(parts, fmt.Sprintf("%d-%d", s[0], s[1]))
 		}
-		start = nums[i]
-		prev = nums[i]
-	}
-	if start == prev {
-		parts = append(parts, fmt.Sprintf("%d", start))
-	} else {
-		parts = append(parts, fmt.Sprintf("%d-%d", start, prev))
 	}
 	return strings.Join(parts, ", ")
 }
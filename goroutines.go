@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	goroutineHeader = regexp.MustCompile(`^goroutine (\d+)\b.*\[(.*)\]:$`)
+	goroutineWait   = regexp.MustCompile(`, (\d+) minutes`)
+	goroutinePanic  = regexp.MustCompile(`^(panic: |fatal error: |\[signal |\t)`)
+	// goFrameArgs and goFrameOffset are what differs between goroutines
+	// sitting in the same code: argument values and the PC offset.
+	goFrameArgs   = regexp.MustCompile(`\([^()]*\)$`)
+	goFrameOffset = regexp.MustCompile(` \+0x[0-9a-f]+$`)
+	goCreatedIn   = regexp.MustCompile(` in goroutine \d+$`)
+)
+
+// goroutine is one stack in a dump.
+type goroutine struct {
+	summaryItem
+	id      int
+	state   string
+	minutes int
+	// frames is the stack without argument values or offsets, and top is
+	// its innermost function.
+	frames []string
+	top    string
+	panic  bool
+}
+
+// goroutineGroup is the goroutines with the same state and stack. The
+// first one stands for the rest.
+type goroutineGroup struct {
+	*goroutine
+	count                  int
+	minMinutes, maxMinutes int
+}
+
+// goroutineSummarizer groups the stacks of a Go goroutine dump, as
+// printed on a panic with GOTRACEBACK=all or on SIGQUIT.
+type goroutineSummarizer struct {
+	cur *goroutine
+	// panicLines is the panic message waiting for the goroutine that
+	// panicked, which Go prints next.
+	panicLines *summaryItem
+	panicked   *goroutine
+	groups     map[string]*goroutineGroup
+	order      []*goroutineGroup
+	states     map[string]int
+	total      int
+}
+
+func newGoroutineSummarizer() *goroutineSummarizer {
+	return &goroutineSummarizer{groups: make(map[string]*goroutineGroup), states: make(map[string]int)}
+}
+
+func (s *goroutineSummarizer) add(num int, text string) {
+	if m := goroutineHeader.FindStringSubmatch(text); m != nil {
+		s.finish()
+		g := &goroutine{}
+		g.id, _ = strconv.Atoi(m[1])
+		g.state = m[2]
+		if w := goroutineWait.FindStringSubmatch(g.state); w != nil {
+			g.minutes, _ = strconv.Atoi(w[1])
+			g.state = strings.Replace(g.state, w[0], "", 1)
+		}
+		if s.panicLines != nil {
+			g.panic = true
+			g.summaryItem = *s.panicLines
+			s.panicLines = nil
+		}
+		g.addLine(num, text)
+		s.cur = g
+		return
+	}
+	if s.cur != nil {
+		if goTraceLine.MatchString(text) && !strings.HasPrefix(text, "goroutine ") {
+			s.frame(num, text)
+			return
+		}
+		s.finish()
+	}
+	switch {
+	case s.panicked == nil && (strings.HasPrefix(text, "panic: ") || strings.HasPrefix(text, "fatal error: ")):
+		if s.panicLines == nil {
+			s.panicLines = &summaryItem{}
+		}
+		s.panicLines.addLine(num, text)
+	case s.panicLines != nil && goroutinePanic.MatchString(text):
+		s.panicLines.addLine(num, text)
+	}
+}
+
+// frame adds a line of the current goroutine's stack.
+func (s *goroutineSummarizer) frame(num int, text string) {
+	g := s.cur
+	g.addLine(num, text)
+	var f string
+	if strings.HasPrefix(text, "\t") {
+		f = goFrameOffset.ReplaceAllString(text, "")
+	} else {
+		f = goCreatedIn.ReplaceAllString(goFrameArgs.ReplaceAllString(text, ""), "")
+		if g.top == "" {
+			g.top = f
+		}
+	}
+	g.frames = append(g.frames, f)
+}
+
+// finish files the current goroutine under its group.
+func (s *goroutineSummarizer) finish() {
+	g := s.cur
+	if g == nil {
+		return
+	}
+	s.cur = nil
+	s.total++
+	s.states[g.state]++
+	if g.panic {
+		s.panicked = g
+		return
+	}
+	key := g.state + "\n" + strings.Join(g.frames, "\n")
+	grp := s.groups[key]
+	if grp == nil {
+		grp = &goroutineGroup{goroutine: g, minMinutes: g.minutes, maxMinutes: g.minutes}
+		s.groups[key] = grp
+		s.order = append(s.order, grp)
+	}
+	grp.count++
+	grp.minMinutes = min(grp.minMinutes, g.minutes)
+	grp.maxMinutes = max(grp.maxMinutes, g.minutes)
+}
+
+func (s *goroutineSummarizer) report() *summaryReport {
+	s.finish()
+	rep := &summaryReport{Name: "goroutines", Counts: make(map[string]int), Items: []summaryItem{}}
+	if s.total == 0 {
+		rep.segments = []string{"no goroutine dump found"}
+		return rep
+	}
+
+	if g := s.panicked; g != nil {
+		it := g.summaryItem
+		it.Kind = "panic"
+		it.Title = fmt.Sprintf("PANIC in goroutine %d [%s]: %s", g.id, g.state, it.lines[0].text)
+		it.Locations = findLocations(it.lines)
+		rep.Items = append(rep.Items, it)
+	}
+	// Biggest groups first: a leak or deadlock shows up as one stack
+	// shared by many goroutines.
+	sort.SliceStable(s.order, func(i, j int) bool { return s.order[i].count > s.order[j].count })
+	for _, grp := range s.order {
+		it := grp.summaryItem
+		it.Kind = "goroutines"
+		state := grp.state
+		switch {
+		case grp.maxMinutes == 0:
+		case grp.minMinutes == grp.maxMinutes:
+			state += fmt.Sprintf(", %d minutes", grp.maxMinutes)
+		default:
+			state += fmt.Sprintf(", %d-%d minutes", grp.minMinutes, grp.maxMinutes)
+		}
+		it.Title = fmt.Sprintf("%s [%s]", plural(grp.count, "goroutine"), state)
+		if grp.top != "" {
+			it.Title += " in " + grp.top
+		}
+		it.Locations = findLocations(it.lines)
+		it.Counts = map[string]int{"goroutines": grp.count}
+		rep.Items = append(rep.Items, it)
+	}
+
+	rep.Counts["goroutines"] = s.total
+	rep.Counts["stacks"] = len(rep.Items)
+	var states []string
+	for st := range s.states {
+		states = append(states, st)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if s.states[states[i]] != s.states[states[j]] {
+			return s.states[states[i]] > s.states[states[j]]
+		}
+		return states[i] < states[j]
+	})
+	var parts []string
+	for _, st := range states {
+		parts = append(parts, fmt.Sprintf("%d %s", s.states[st], st))
+	}
+	rep.segments = []string{
+		fmt.Sprintf("goroutines: %d in %s", s.total, plural(len(rep.Items), "distinct stack")),
+		"states: " + strings.Join(parts, ", "),
+	}
+	if g := s.panicked; g != nil {
+		rep.segments = append(rep.segments, fmt.Sprintf("panic in goroutine %d", g.id))
+	}
+	return rep
+}
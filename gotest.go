@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+var (
+	goTestResult  = regexp.MustCompile(`^(\s*)--- (FAIL|PASS|SKIP): (\S+)(?: \(([\d.]+s)\))?`)
+	goTestRun     = regexp.MustCompile(`^=== (RUN|CONT|NAME|PAUSE)\s+(\S+)`)
+	goTestPackage = regexp.MustCompile(`^(ok|FAIL|\?)\s+(\S+)(.*)$`)
+	goBuildHeader = regexp.MustCompile(`^# (\S+)`)
+)
+
+// testEvent is the part of a go test -json event we need.
+type testEvent struct {
+	Action     string
+	Package    string
+	ImportPath string
+	Test       string
+	Output     string
+}
+
+// parseTestEvent decodes a go test -json line. Only output events carry
+// text; the rest are already reflected in it.
+func parseTestEvent(s string) (testEvent, bool) {
+	var ev testEvent
+	if !strings.HasPrefix(s, `{"`) || json.Unmarshal([]byte(s), &ev) != nil || ev.Action == "" {
+		return ev, false
+	}
+	return ev, true
+}
+
+// goTestItem is a failed test or build while its package is not yet known.
+type goTestItem struct {
+	summaryItem
+	name    string
+	pkg     string
+	elapsed string
+}
+
+// goTestSummarizer reads go test output, plain or -json, and reports
+// failed tests and builds with the lines that explain them.
+type goTestSummarizer struct {
+	items []*goTestItem
+	// cur is the item whose lines are being collected.
+	cur *goTestItem
+	// running is the test whose output is streaming in -v mode, and
+	// pending its output so far, kept in case it fails.
+	running string
+	pending map[string]*summaryItem
+	// packages counts ok/FAIL/? lines and tests --- result lines.
+	packages map[string]int
+	tests    map[string]int
+}
+
+func newGoTestSummarizer() *goTestSummarizer {
+	return &goTestSummarizer{
+		pending:  make(map[string]*summaryItem),
+		packages: make(map[string]int),
+		tests:    make(map[string]int),
+	}
+}
+
+func (s *goTestSummarizer) add(num int, text string) {
+	pkg, test := "", ""
+	if ev, ok := parseTestEvent(text); ok {
+		if ev.Action != "output" && ev.Action != "build-output" {
+			return
+		}
+		text = strings.TrimRight(ev.Output, "\n")
+		pkg, test = ev.Package, ev.Test
+		if pkg == "" {
+			pkg, _, _ = strings.Cut(ev.ImportPath, " ")
+		}
+	}
+	s.line(num, text, pkg, test)
+}
+
+func (s *goTestSummarizer) line(num int, text, pkg, test string) {
+	if m := goTestResult.FindStringSubmatch(text); m != nil {
+		s.cur = nil
+		name := m[3]
+		p := s.pending[name]
+		delete(s.pending, name)
+		switch m[2] {
+		case "PASS":
+			s.tests["passed"]++
+		case "SKIP":
+			s.tests["skipped"]++
+		case "FAIL":
+			s.tests["failed"]++
+			it := &goTestItem{name: name, pkg: pkg, elapsed: m[4]}
+			if p != nil {
+				// -v output streamed before the result line
+				it.summaryItem = *p
+			}
+			it.Kind = "test"
+			it.addLine(num, text)
+			s.items = append(s.items, it)
+			s.cur = it
+		}
+		return
+	}
+	if m := goTestRun.FindStringSubmatch(text); m != nil {
+		s.cur = nil
+		s.running = m[2]
+		if m[1] == "PAUSE" {
+			s.running = ""
+		}
+		return
+	}
+	if m := goBuildHeader.FindStringSubmatch(text); m != nil {
+		it := &goTestItem{pkg: m[1]}
+		it.Kind = "build"
+		it.addLine(num, text)
+		s.items = append(s.items, it)
+		s.cur = it
+		return
+	}
+	if m := goTestPackage.FindStringSubmatch(text); m != nil {
+		s.cur = nil
+		s.running = ""
+		s.packageResult(m[1], m[2], m[3])
+		return
+	}
+	if text == "PASS" || text == "FAIL" {
+		s.cur = nil
+		return
+	}
+	if s.cur != nil {
+		s.cur.addLine(num, text)
+		return
+	}
+	if test == "" {
+		test = s.running
+	}
+	if test != "" {
+		p := s.pending[test]
+		if p == nil {
+			p = &summaryItem{}
+			s.pending[test] = p
+		}
+		p.addLine(num, text)
+	}
+}
+
+// packageResult counts an ok/FAIL/? line and assigns its package to the
+// failed tests before it.
+func (s *goTestSummarizer) packageResult(status, pkg, rest string) {
+	switch {
+	case status == "ok":
+		s.packages["ok"]++
+	case status == "?":
+		s.packages["no tests"]++
+	case strings.Contains(rest, "[build failed]") || strings.Contains(rest, "[setup failed]"):
+		s.packages["build failed"]++
+	default:
+		s.packages["failed"]++
+	}
+	for i := len(s.items) - 1; i >= 0 && s.items[i].pkg == ""; i-- {
+		s.items[i].pkg = pkg
+	}
+	for name := range s.pending {
+		delete(s.pending, name)
+	}
+}
+
+func (s *goTestSummarizer) report() *summaryReport {
+	rep := &summaryReport{Name: "gotest", Counts: make(map[string]int), Items: []summaryItem{}}
+	for _, it := range s.items {
+		if it.Kind == "test" && it.Line == it.End && s.hasFailedSubtest(it.name) {
+			// Only says its subtests failed; they have their own items.
+			continue
+		}
+		switch it.Kind {
+		case "build":
+			it.Title = "BUILD FAILED " + it.pkg
+		default:
+			it.Title = "FAIL " + it.name
+			var detail []string
+			if it.pkg != "" {
+				detail = append(detail, it.pkg)
+			}
+			if it.elapsed != "" {
+				detail = append(detail, it.elapsed)
+			}
+			if len(detail) > 0 {
+				it.Title += " (" + strings.Join(detail, ", ") + ")"
+			}
+		}
+		it.Locations = findLocations(it.lines)
+		rep.Items = append(rep.Items, it.summaryItem)
+	}
+
+	for k, n := range s.packages {
+		rep.Counts["packages_"+strings.ReplaceAll(k, " ", "_")] = n
+	}
+	for k, n := range s.tests {
+		rep.Counts["tests_"+k] = n
+	}
+	for _, seg := range []string{
+		countSegment("packages", s.packages, "ok", "failed", "build failed", "no tests"),
+		countSegment("tests", s.tests, "passed", "failed", "skipped"),
+	} {
+		if seg != "" {
+			rep.segments = append(rep.segments, seg)
+		}
+	}
+	if len(rep.segments) == 0 {
+		rep.segments = []string{"no go test results found"}
+	}
+	return rep
+}
+
+func (s *goTestSummarizer) hasFailedSubtest(name string) bool {
+	for _, it := range s.items {
+		if strings.HasPrefix(it.name, name+"/") {
+			return true
+		}
+	}
+	return false
+}
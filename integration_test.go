@@ -1,10 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"sync"
@@ -208,6 +210,88 @@ func TestFiltering(t *testing.T) {
 		assertContains(t, "matches custom", out, `custom_match`)
 	})
 
+	t.Run("exclude", func(t *testing.T) {
+		input := seqInput(50) + "ERROR real\n" + seqInput(50) + "ERROR retrying\n" + seqInput(50)
+		out, _, _ := run(t, input, "-p", "errors", "-x", "retrying")
+		assertContains(t, "keeps real", out, `ERROR real`)
+		assertNotContains(t, "drops noise", out, `ERROR retrying`)
+	})
+
+	t.Run("exclude preset", func(t *testing.T) {
+		input := seqInput(50) + "ERROR real\n" + seqInput(50) + "ERROR deprecated call\n" + seqInput(50)
+		out, _, _ := run(t, input, "-p", "errors", "-X", "warnings")
+		assertContains(t, "keeps real", out, `ERROR real`)
+		assertNotContains(t, "drops warning", out, `deprecated`)
+	})
+
+	t.Run("exclude does not hide head or tail", func(t *testing.T) {
+		out, _, _ := run(t, "ERROR retrying\n"+seqInput(50), "-n", "2", "-p", "errors", "-x", "retrying")
+		assertContains(t, "head kept", out, `1: ERROR retrying`)
+	})
+
+	t.Run("builtin errors preset exclusions", func(t *testing.T) {
+		input := seqInput(30) + "panic: value is expected to be non-nil\n" + "ERROR write to stderr failed\n" +
+			"[stderr] error: boom\n" + "build ok: 0 errors\n" + "no failures\n" + seqInput(30)
+		out, _, _ := run(t, input, "-p", "errors")
+		assertContains(t, "is expected", out, `panic: value is expected to be non-nil`)
+		assertContains(t, "stderr", out, `ERROR write to stderr failed`)
+		assertContains(t, "tagged stderr", out, `\[stderr\] error: boom`)
+		assertNotContains(t, "0 errors", out, `0 errors`)
+		assertNotContains(t, "no failures", out, `no failures`)
+		assertContains(t, "count", out, `errors: 3 `)
+	})
+
+	t.Run("run --tag-stderr errors", func(t *testing.T) {
+		out, _, _ := run(t, "", "run", "--tag-stderr", "-n", "1", "-p", "errors", "--", "sh", "-c", "seq 20; echo 'error: boom' >&2; seq 20")
+		assertContains(t, "stderr error", out, `\[stderr\] error: boom`)
+	})
+
+	t.Run("query", func(t *testing.T) {
+		input := seqInput(50) + "ERROR db down\n" + "ERROR db timeout\n" + "ERROR cache down\n" + seqInput(50)
+		out, _, _ := run(t, input, "-q", "errors AND /db/ AND NOT /timeout/")
+		assertContains(t, "matches", out, `ERROR db down`)
+		assertNotContains(t, "not timeout", out, `ERROR db timeout`)
+		assertNotContains(t, "not cache", out, `ERROR cache down`)
+	})
+
+	t.Run("query ORs with filters", func(t *testing.T) {
+		input := seqInput(50) + "ERROR db down\n" + "custom\n" + seqInput(50)
+		out, _, _ := run(t, input, "-q", "/db/", "-f", "custom")
+		assertContains(t, "query", out, `ERROR db down`)
+		assertContains(t, "filter", out, `custom`)
+	})
+
+	t.Run("query parse error", func(t *testing.T) {
+		_, stderr, code := run(t, seqInput(10), "-q", "errors AND (/db/")
+		if code == 0 {
+			t.Error("expected failure")
+		}
+		assertContains(t, "position", stderr, `expected "\)" at position 17`)
+		assertContains(t, "caret", stderr, `\n\s+\^`)
+	})
+
+	t.Run("fixed strings", func(t *testing.T) {
+		input := seqInput(50) + "index a.b[0] out of range\n" + "axb[0]\n" + seqInput(50)
+		out, _, _ := run(t, input, "-F", "-f", "a.b[0]")
+		assertContains(t, "literal", out, `a\.b\[0\] out of range`)
+		assertNotContains(t, "not regex", out, `axb`)
+	})
+
+	t.Run("many literals", func(t *testing.T) {
+		input := seqInput(50) + "pkg github.com/x/one failed\n" + "Pkg GitHub.com/X/Two\n" + "github.com/x/three\n" + seqInput(50)
+		out, _, _ := run(t, input, "-F", "-i", "-f", "github.com/x/one", "-f", "github.com/x/two", "-f", "github.com/x/four")
+		assertContains(t, "one", out, `github.com/x/one failed`)
+		assertContains(t, "two ignoring case", out, `GitHub.com/X/Two`)
+		assertNotContains(t, "not three", out, `three`)
+	})
+
+	t.Run("word", func(t *testing.T) {
+		input := seqInput(50) + "writing to stderr\n" + "err: boom\n" + seqInput(50)
+		out, _, _ := run(t, input, "-fw", "err")
+		assertContains(t, "word", out, `err: boom`)
+		assertNotContains(t, "not inside word", out, `stderr`)
+	})
+
 	t.Run("no match", func(t *testing.T) {
 		out, _, _ := run(t, seqInput(100), "-f", "NOMATCH")
 		assertContains(t, "showing 20", out, `showing 20`)
@@ -223,6 +307,159 @@ func TestFiltering(t *testing.T) {
 	})
 }
 
+func TestContext(t *testing.T) {
+	t.Run("before and after", func(t *testing.T) {
+		out, _, _ := run(t, seqInput(100), "-n", "3", "-f", `^50$`, "-C", "2")
+		for _, n := range []string{"48", "49", "50", "51", "52"} {
+			assertContains(t, "line "+n, out, `\b`+n+`: `+n+`\n`)
+		}
+		assertNotContains(t, "no 47", out, `47: 47`)
+		assertNotContains(t, "no 53", out, `53: 53`)
+		assertContains(t, "sections", out, `sections: 1-3, 48-52, 98-100`)
+	})
+
+	t.Run("only before", func(t *testing.T) {
+		out, _, _ := run(t, seqInput(100), "-n", "3", "-f", `^50$`, "-B", "2")
+		assertContains(t, "sections", out, `sections: 1-3, 48-50, 98-100`)
+	})
+
+	t.Run("only after", func(t *testing.T) {
+		out, _, _ := run(t, seqInput(100), "-n", "3", "-f", `^50$`, "-A", "2")
+		assertContains(t, "sections", out, `sections: 1-3, 50-52, 98-100`)
+	})
+
+	t.Run("overlapping windows merge", func(t *testing.T) {
+		out, _, _ := run(t, seqInput(100), "-n", "3", "-f", `^(50|53)$`, "-C", "2")
+		assertContains(t, "merged", out, `sections: 1-3, 48-55, 98-100`)
+		if c := strings.Count(out, "51: 51\n"); c != 1 {
+			t.Errorf("line 51 printed %d times, want 1", c)
+		}
+	})
+
+	t.Run("after context from head", func(t *testing.T) {
+		out, _, _ := run(t, seqInput(100), "-n", "3", "-f", `^3$`, "-A", "2")
+		assertContains(t, "extends head", out, `sections: 1-5, 98-100`)
+	})
+
+	t.Run("before context into tail", func(t *testing.T) {
+		out, _, _ := run(t, seqInput(100), "-n", "3", "-f", `^98$`, "-B", "2")
+		assertContains(t, "extends tail", out, `sections: 1-3, 96-100`)
+	})
+
+	t.Run("before context does not repeat head", func(t *testing.T) {
+		out, _, _ := run(t, seqInput(100), "-n", "3", "-f", `^4$`, "-B", "5")
+		assertContains(t, "sections", out, `sections: 1-4, 98-100`)
+		if c := strings.Count(out, "\n2: 2\n"); c != 1 {
+			t.Errorf("line 2 printed %d times, want 1", c)
+		}
+	})
+}
+
+func TestBudget(t *testing.T) {
+	var b strings.Builder
+	for i := 1; i <= 1000; i++ {
+		if i%10 == 7 {
+			fmt.Fprintf(&b, "ERROR %d\n", i)
+		} else {
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+	}
+	input := b.String()
+
+	t.Run("caps output and reports hidden", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run(input, "-n", "2", "-p", "errors", "--budget", "20")
+		assertContains(t, "showing 20", out, `showing 20`)
+		assertContains(t, "first match", out, `\b7: ERROR 7\n`)
+		assertContains(t, "last match", out, `997: ERROR 997`)
+		assertContains(t, "hidden count", out, `84 more matches hidden`)
+
+		id := extractID(out)
+		assertContains(t, "reveal command", out, `hidden: glance show `+id+` -p errors ---`)
+		showOut, _, _ := env.run("", "show", id, "-p", "errors")
+		assertContains(t, "show reveals all", showOut, `showing 100`)
+	})
+
+	t.Run("under budget unchanged", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "2", "-p", "errors", "--budget", "500")
+		assertContains(t, "all matches", out, `showing 104`)
+		assertNotContains(t, "nothing hidden", out, `hidden`)
+	})
+
+	t.Run("head and tail always shown", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "5", "-p", "errors", "--budget", "4")
+		assertContains(t, "showing 10", out, `showing 10`)
+		assertContains(t, "all middle hidden", out, `99 more matches hidden`)
+	})
+
+	t.Run("one hidden", func(t *testing.T) {
+		var b strings.Builder
+		for i := 1; i <= 7; i++ {
+			fmt.Fprintf(&b, "x\nERROR %d\n", i)
+		}
+		out, _, _ := run(t, "a\nb\n"+b.String()+"y\nz\n", "-n", "2", "-p", "errors", "--budget", "10", "--no-store")
+		assertContains(t, "singular", out, `\| 1 more match hidden ---`)
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "2", "-p", "errors", "--budget", "60t", "--no-store")
+		assertContains(t, "hidden", out, `more matches hidden ---`)
+		assertNotContains(t, "no reveal without id", out, `glance show`)
+	})
+
+	t.Run("context travels with its match", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "2", "-p", "errors", "-A", "1", "--budget", "10")
+		assertContains(t, "match and context", out, `7: ERROR 7\n8: 8\n`)
+		assertNotContains(t, "no orphan context", out, `\n28: 28\n`)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, stderr, _ := run(t, input, "--budget", "lots")
+		assertContains(t, "error", stderr, `--budget must be`)
+	})
+}
+
+func TestCollapse(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("starting\n")
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(&b, "Waiting for db... attempt %d\n", i)
+	}
+	for i := 0; i < 3; i++ {
+		b.WriteString("Waiting for db...\n")
+	}
+	b.WriteString("ready\n")
+	input := b.String()
+
+	t.Run("pipe exact", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "3", "-f", "Waiting", "--collapse")
+		assertContains(t, "identical folded", out, `302-304: \(x3\) Waiting for db\.\.\.\n`)
+		assertContains(t, "numbered lines kept", out, `\n3: Waiting for db... attempt 2\n`)
+		assertContains(t, "footer", out, `showing 305 \| sections: 1-305 \| Waiting: 303 \(first 2, last 304\) \| collapsed 2 ---`)
+	})
+
+	t.Run("pipe similar", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "3", "-f", "Waiting", "--collapse-similar")
+		assertContains(t, "head run", out, `2-301: \(x300\) Waiting for db\.\.\. attempt 1\n`)
+		assertContains(t, "separate shape", out, `302-304: \(x3\) Waiting for db\.\.\.\n`)
+		assertContains(t, "collapsed count", out, `collapsed 301`)
+	})
+
+	t.Run("show", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run(input)
+		id := extractID(out)
+
+		out, _, _ = env.run("", "show", id, "--collapse-similar")
+		assertContains(t, "all lines", out, `1: starting\n2-301: \(x300\) `)
+		assertContains(t, "last line", out, `305: ready\n`)
+		assertContains(t, "showing all", out, `showing 305`)
+
+		out, _, _ = env.run("", "show", id, "-l", "100-110", "--collapse-similar")
+		assertContains(t, "range folded", out, `^100-110: \(x11\) Waiting for db\.\.\. attempt 99\n`)
+	})
+}
+
 func TestOutputFormat(t *testing.T) {
 	t.Run("has id", func(t *testing.T) {
 		out, _, _ := run(t, seqInput(10))
@@ -341,12 +578,61 @@ func TestShow(t *testing.T) {
 	})
 }
 
+func TestClusters(t *testing.T) {
+	env := newTestEnv(t)
+	var b strings.Builder
+	for i := 1; i <= 200; i++ {
+		fmt.Fprintf(&b, "GET /api/users/%d 200 %dms\n", i, i%17)
+		if i == 120 {
+			b.WriteString("panic: assignment to entry in nil map\n")
+		}
+	}
+	out, _, _ := env.run(b.String())
+	id := extractID(out)
+
+	t.Run("templates", func(t *testing.T) {
+		out, _, _ := env.run("", "clusters", id)
+		assertContains(t, "common template", out, `\s200\s+1\s+201\s+GET <\*> <\*> <\*>\n`)
+		assertContains(t, "example", out, `1: GET /api/users/1 200 1ms`)
+		assertContains(t, "rare flagged", out, `\s1\s+121\s+121 ! panic: assignment to entry in nil map`)
+		assertContains(t, "footer", out, `--- glance clusters `+id+` \| 201 lines \| 2 templates \| 1 rare`)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, stderr, _ := env.run("", "clusters", "nope")
+		assertContains(t, "error", stderr, `capture not found`)
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		_, stderr, _ := env.run("", "clusters", "../x")
+		assertContains(t, "error", stderr, `invalid capture ID`)
+	})
+}
+
 func TestUnifiedFlags(t *testing.T) {
 	env := newTestEnv(t)
 
 	t.Run("pipe --head", func(t *testing.T) {
 		out, _, _ := env.run(seqInput(500), "--head", "3")
-		assertContains(t, "showing 6", out, `showing 6`)
+		assertContains(t, "showing 13", out, `showing 13`)
+		assertContains(t, "windows", out, `sections: 1-3, 491-500 \| head: 1-3 \| tail: 491-500 ---`)
+	})
+
+	t.Run("pipe --tail", func(t *testing.T) {
+		out, _, _ := env.run(seqInput(500), "--head", "0", "--tail", "2")
+		assertContains(t, "only tail", out, `^499: 499\n500: 500\n`)
+		assertContains(t, "windows", out, `head: none \| tail: 499-500 ---`)
+	})
+
+	t.Run("pipe --tail 0", func(t *testing.T) {
+		input := seqInput(50) + "ERROR x\n" + seqInput(50)
+		out, _, _ := env.run(input, "--head", "2", "--tail", "0", "-p", "errors")
+		assertContains(t, "head and match", out, `sections: 1-2, 51 \| head: 1-2 \| tail: none \| errors: 1 \(line 51\) ---`)
+	})
+
+	t.Run("pipe -n keeps footer short", func(t *testing.T) {
+		out, _, _ := env.run(seqInput(500), "-n", "3")
+		assertNotContains(t, "no windows", out, `head:`)
 	})
 
 	// Store a capture for show flag tests
@@ -369,6 +655,25 @@ func TestUnifiedFlags(t *testing.T) {
 		assertContains(t, "--preset matches", out, `ERROR something`)
 	})
 
+	t.Run("show -x", func(t *testing.T) {
+		storeOut, _, _ := env.run("ERROR one\nERROR two\nline3\n")
+		pid := extractID(storeOut)
+
+		out, _, _ := env.run("", "show", pid, "-p", "errors", "--exclude", "two")
+		assertContains(t, "keeps one", out, `ERROR one`)
+		assertNotContains(t, "drops two", out, `ERROR two`)
+	})
+
+	t.Run("show -q", func(t *testing.T) {
+		storeOut, _, _ := env.run("ERROR db\nERROR cache\nline3\n")
+		pid := extractID(storeOut)
+
+		out, _, _ := env.run("", "show", pid, "-q", "errors AND NOT /cache/")
+		assertContains(t, "keeps db", out, `1: ERROR db`)
+		assertNotContains(t, "drops cache", out, `ERROR cache`)
+		assertContains(t, "showing 1", out, `showing 1 `)
+	})
+
 	t.Run("show -l", func(t *testing.T) {
 		out, _, _ := env.run("", "show", id, "-l", "5-10")
 		assertContains(t, "starts with 5", out, `5: 5`)
@@ -486,6 +791,22 @@ func TestPresets(t *testing.T) {
 		assertContains(t, "uses new regex", out, `new_regex match`)
 	})
 
+	t.Run("preset with exclusions", func(t *testing.T) {
+		env2 := newTestEnv(t)
+		env2.run("", "presets", "add", "-x", "healthz", "http", "HTTP [45][0-9][0-9]", "HTTP failures")
+
+		out, _, _ := env2.run("", "presets", "list")
+		assertContains(t, "listed", out, `exclude: healthz`)
+
+		input := seqInput(50) + "HTTP 503 /healthz\n" + seqInput(50) + "HTTP 500 /api\n" + seqInput(50)
+		out, _, _ = env2.run(input, "-p", "http")
+		assertContains(t, "keeps api", out, `HTTP 500 /api`)
+		assertNotContains(t, "drops healthz", out, `healthz`)
+
+		out, _, _ = env2.run(input, "-x", "api", "-X", "http", "-f", "HTTP")
+		assertNotContains(t, "exclude preset", out, `HTTP 500`)
+	})
+
 	t.Run("unknown preset", func(t *testing.T) {
 		_, stderr, _ := env.run(seqInput(10), "-p", "nonexistent")
 		assertContains(t, "error", stderr, `unknown preset`)
@@ -747,6 +1068,973 @@ func TestRegex(t *testing.T) {
 	})
 }
 
+func TestRun(t *testing.T) {
+	t.Run("exit status and timing", func(t *testing.T) {
+		out, _, code := run(t, "", "run", "--", "sh", "-c", "seq 30; exit 3")
+		if code != 3 {
+			t.Errorf("exit code = %d, want 3", code)
+		}
+		assertContains(t, "30 lines", out, `30 lines`)
+		assertContains(t, "exit in footer", out, `\| exit 3 \| [0-9.]+m?s ---`)
+		assertContains(t, "has id", out, `id=`)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		out, _, code := run(t, "", "run", "sh", "-c", "echo hi")
+		if code != 0 {
+			t.Errorf("exit code = %d, want 0", code)
+		}
+		assertContains(t, "output", out, `1: hi`)
+		assertContains(t, "exit 0", out, `exit 0`)
+	})
+
+	t.Run("command with its own separator", func(t *testing.T) {
+		out, _, code := run(t, "", "run", "sh", "-c", `echo "args: $*"`, "sh", "--", "-v")
+		if code != 0 {
+			t.Errorf("exit code = %d, want 0", code)
+		}
+		assertContains(t, "args passed through", out, `1: args: -- -v\n`)
+	})
+
+	t.Run("stderr merged", func(t *testing.T) {
+		out, _, _ := run(t, "", "run", "--", "sh", "-c", "echo out; echo err >&2")
+		assertContains(t, "stdout", out, `: out`)
+		assertContains(t, "stderr", out, `: err`)
+		assertNotContains(t, "untagged", out, `\[stderr\]`)
+	})
+
+	t.Run("stderr tagged", func(t *testing.T) {
+		out, _, _ := run(t, "", "run", "--tag-stderr", "--", "sh", "-c", "echo out; echo err >&2")
+		assertContains(t, "stdout untagged", out, `\d: out`)
+		assertContains(t, "stderr tagged", out, `\d: \[stderr\] err`)
+	})
+
+	t.Run("filters apply", func(t *testing.T) {
+		out, _, _ := run(t, "", "run", "-n", "2", "-p", "errors", "--", "sh", "-c", "seq 20; echo ERROR boom; seq 20")
+		assertContains(t, "match", out, `21: ERROR boom`)
+		assertContains(t, "showing 5", out, `showing 5`)
+	})
+
+	t.Run("signal", func(t *testing.T) {
+		out, _, code := run(t, "", "run", "--", "sh", "-c", "echo start; kill -TERM $$")
+		if code != 128+15 {
+			t.Errorf("exit code = %d, want %d", code, 128+15)
+		}
+		assertContains(t, "signal in footer", out, `signal terminated`)
+	})
+
+	t.Run("capture stored", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run("", "run", "--", "sh", "-c", "seq 40")
+		id := extractID(out)
+		showOut, _, _ := env.run("", "show", id, "-l", "40-40")
+		assertContains(t, "stored", showOut, `40: 40`)
+	})
+
+	t.Run("command not found", func(t *testing.T) {
+		_, stderr, code := run(t, "", "run", "--", "glance-no-such-command")
+		if code != 127 {
+			t.Errorf("exit code = %d, want 127", code)
+		}
+		assertContains(t, "error", stderr, `not found`)
+	})
+
+	t.Run("missing command", func(t *testing.T) {
+		_, stderr, code := run(t, "", "run", "-n", "3", "--")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "usage", stderr, `usage: glance run`)
+	})
+}
+
+func TestFilterStats(t *testing.T) {
+	var b strings.Builder
+	for i := 1; i <= 3000; i++ {
+		switch {
+		case i%70 == 31:
+			fmt.Fprintf(&b, "ERROR job %d failed\n", i)
+		case i == 1500:
+			b.WriteString("WARN disk almost full\n")
+		default:
+			fmt.Fprintf(&b, "ok %d\n", i)
+		}
+	}
+	input := b.String()
+
+	t.Run("pipe counts all matches", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run(input, "-p", "errors", "-f", "WARN", "-f", "timeout", "--budget", "25")
+		assertContains(t, "errors", out, `\| errors: 43 \(first 31, last 2971\)`)
+		assertContains(t, "single", out, `\| WARN: 1 \(line 1500\)`)
+		assertContains(t, "no matches", out, `\| timeout: 0`)
+		assertContains(t, "hidden", out, `more matches hidden`)
+
+		id := extractID(out)
+		showOut, _, _ := env.run("", "show", id, "-l", "1-5", "-f", "WARN")
+		assertContains(t, "show footer", showOut, `sections: 1-5, 1500 \| WARN: 1 \(line 1500\) ---`)
+	})
+
+	t.Run("includes head and tail matches", func(t *testing.T) {
+		out, _, _ := run(t, "ERROR a\nok\nok\nERROR b\n", "-n", "1", "-p", "errors")
+		assertContains(t, "both windows", out, `errors: 2 \(first 1, last 4\)`)
+	})
+
+	t.Run("no filters", func(t *testing.T) {
+		out, _, _ := run(t, input)
+		assertContains(t, "plain footer", out, `sections: 1-10, 2991-3000 ---`)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, _, _ := run(t, input, "-p", "errors", "--format", "json")
+		assertContains(t, "filters", out, `"filters":\[\{"name":"errors","count":43,"first":31,"last":2971\}\]`)
+	})
+}
+
+func TestJSONLinesInput(t *testing.T) {
+	var b strings.Builder
+	for i := 1; i <= 100; i++ {
+		level, status := "info", 200
+		switch {
+		case i%25 == 0:
+			level, status = "error", 503
+		case i%10 == 0:
+			status = 404
+		}
+		fmt.Fprintf(&b, `{"ts":"t%d","level":"%s","msg":"request %d","http":{"status":%d},"trace":"abcdef"}`+"\n", i, level, i, status)
+		if i == 50 {
+			b.WriteString("panic: something broke\n")
+		}
+	}
+	input := b.String()
+
+	t.Run("where", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "1", "--where", "level=error")
+		assertContains(t, "error", out, `25: \{"ts":"t25","level":"error"`)
+		assertNotContains(t, "info", out, `\n1[0-9]: `)
+		assertContains(t, "stats", out, `level=error: 4 \(first 25, last 101\)`)
+	})
+
+	t.Run("where numeric and nested", func(t *testing.T) {
+		out, _, _ := run(t, input, "--head", "0", "--tail", "0", "--where", "http.status>=400", "--where", "http.status<500")
+		assertContains(t, "404", out, `showing 8 `)
+		assertNotContains(t, "503", out, `"status":503`)
+	})
+
+	t.Run("where narrows filters", func(t *testing.T) {
+		out, _, _ := run(t, input, "--head", "0", "--tail", "0", "-f", "request [0-9]*5\"", "--where", "level=error")
+		assertContains(t, "narrowed", out, `sections: 25, 76 \|`)
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "2", "--fields", "ts,level,http.status")
+		assertContains(t, "projected", out, `1: \{"ts":"t1","level":"info","http.status":200\}\n`)
+		assertNotContains(t, "dropped", out, `trace`)
+	})
+
+	t.Run("non-json lines", func(t *testing.T) {
+		out, _, _ := run(t, input, "--json", "--fields", "msg", "-f", "panic")
+		assertContains(t, "untouched", out, `51: panic: something broke\n`)
+		assertContains(t, "counted", out, `\| non-json 1 ---`)
+
+		out, _, _ = run(t, input, "--fields", "msg")
+		assertNotContains(t, "no count without --json", out, `non-json`)
+	})
+
+	t.Run("show", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run(input)
+		id := extractID(out)
+		out, _, _ = env.run("", "show", id, "--where", "level=error", "--fields", "msg")
+		assertContains(t, "lines", out, `^25: \{"msg":"request 25"\}\n50: \{"msg":"request 50"\}\n`)
+		assertContains(t, "footer", out, `showing 4 \| sections: 25, 50, 76, 101 \| level=error: 4`)
+
+		out, _, _ = env.run("", "show", id, "--fields", "level")
+		assertContains(t, "fields alone shows every line", out, `showing 101 `)
+	})
+
+	t.Run("invalid where", func(t *testing.T) {
+		_, stderr, code := run(t, input, "--where", "status>=high")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "error", stderr, `needs a number`)
+	})
+}
+
+func TestLogfmtInput(t *testing.T) {
+	var b strings.Builder
+	for i := 1; i <= 60; i++ {
+		level, dur := "info", "40ms"
+		if i%20 == 0 {
+			level, dur = "warn", "2.5s"
+		}
+		fmt.Fprintf(&b, "time=t%d level=%s msg=\"query %d done\" dur=%s caller=db.go:%d\n", i, level, i, dur, i)
+	}
+	b.WriteString("goroutine 1 [running]:\n")
+	input := b.String()
+
+	t.Run("where and fields", func(t *testing.T) {
+		out, _, _ := run(t, input, "--head", "0", "--tail", "0", "--where", "dur>1s", "--fields", "time,msg,dur")
+		assertContains(t, "projected", out, `^20: time=t20 msg="query 20 done" dur=2.5s\n40: `)
+		assertContains(t, "stats", out, `dur>1s: 3 \(first 20, last 60\)`)
+		assertNotContains(t, "dropped", out, `caller=`)
+	})
+
+	t.Run("quoted values", func(t *testing.T) {
+		out, _, _ := run(t, input, "--head", "0", "--tail", "0", "--where", "msg~^query 4[0-9] ")
+		assertContains(t, "regex on unquoted value", out, `showing 10 `)
+	})
+
+	t.Run("declared", func(t *testing.T) {
+		out, _, _ := run(t, input, "--logfmt", "--where", "level=warn")
+		assertContains(t, "non-logfmt", out, `\| non-logfmt 1 ---`)
+		assertContains(t, "untouched", out, `61: goroutine 1 \[running\]:\n`)
+	})
+
+	t.Run("show", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run(input)
+		id := extractID(out)
+		out, _, _ = env.run("", "show", id, "--where", "level=warn", "--fields", "level,msg", "--format", "json")
+		assertContains(t, "json line", out, `\{"n":20,"text":"level=warn msg=\\"query 20 done\\"","reasons":\["filter"\]`)
+	})
+}
+
+func TestJSONOutput(t *testing.T) {
+	type line struct {
+		Type    string   `json:"type"`
+		N       int      `json:"n"`
+		End     int      `json:"end"`
+		Text    string   `json:"text"`
+		Reasons []string `json:"reasons"`
+		Filters []string `json:"filters"`
+	}
+	type footer struct {
+		Type     string   `json:"type"`
+		Command  string   `json:"command"`
+		ID       string   `json:"id"`
+		Total    int      `json:"total"`
+		Showing  int      `json:"showing"`
+		Sections [][2]int `json:"sections"`
+		Windows  *struct {
+			Head *[2]int `json:"head"`
+			Tail *[2]int `json:"tail"`
+		} `json:"windows"`
+		Exit *int `json:"exit"`
+	}
+	type doc struct {
+		Version int    `json:"version"`
+		Lines   []line `json:"lines"`
+		Footer  footer `json:"footer"`
+	}
+	decode := func(t *testing.T, out string) doc {
+		t.Helper()
+		var d doc
+		if err := json.Unmarshal([]byte(out), &d); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, out)
+		}
+		return d
+	}
+	input := seqInput(30) + "ERROR db <down>\n" + seqInput(30)
+
+	t.Run("pipe json", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "2", "-p", "errors", "-A", "1", "--format", "json")
+		d := decode(t, out)
+		if d.Version != 1 {
+			t.Errorf("version = %d, want 1", d.Version)
+		}
+		var got []string
+		for _, l := range d.Lines {
+			got = append(got, fmt.Sprintf("%d:%s:%v", l.N, strings.Join(l.Reasons, ","), l.Filters))
+		}
+		want := []string{"1:head:[]", "2:head:[]", "31:filter:[errors]", "32:context:[]", "60:tail:[]", "61:tail:[]"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("lines = %v, want %v", got, want)
+		}
+		if d.Lines[2].Text != "ERROR db <down>" {
+			t.Errorf("text = %q", d.Lines[2].Text)
+		}
+		f := d.Footer
+		if f.Command != "pipe" || f.ID == "" || f.Total != 61 || f.Showing != 6 {
+			t.Errorf("footer = %+v", f)
+		}
+		if !reflect.DeepEqual(f.Sections, [][2]int{{1, 2}, {31, 32}, {60, 61}}) {
+			t.Errorf("sections = %v", f.Sections)
+		}
+		if f.Windows == nil || *f.Windows.Head != [2]int{1, 2} || *f.Windows.Tail != [2]int{60, 61} {
+			t.Errorf("windows = %+v", f.Windows)
+		}
+	})
+
+	t.Run("pipe jsonl", func(t *testing.T) {
+		out, _, _ := run(t, input, "--head", "0", "--tail", "1", "-f", "ERROR", "--format", "jsonl")
+		records := strings.Split(strings.TrimSpace(out), "\n")
+		if len(records) != 4 {
+			t.Fatalf("got %d records, want 4:\n%s", len(records), out)
+		}
+		assertContains(t, "header", records[0], `^\{"type":"header","version":1\}$`)
+		var l line
+		json.Unmarshal([]byte(records[1]), &l)
+		if l.Type != "line" || l.N != 31 || !reflect.DeepEqual(l.Filters, []string{"ERROR"}) {
+			t.Errorf("match record = %s", records[1])
+		}
+		var f footer
+		json.Unmarshal([]byte(records[3]), &f)
+		if f.Type != "footer" || f.Windows.Head != nil || f.Showing != 2 {
+			t.Errorf("footer record = %s", records[3])
+		}
+	})
+
+	t.Run("run json", func(t *testing.T) {
+		out, _, code := run(t, "", "run", "--format", "json", "--", "sh", "-c", "echo hi; exit 2")
+		if code != 2 {
+			t.Errorf("exit code = %d, want 2", code)
+		}
+		d := decode(t, out)
+		if d.Footer.Command != "run" || d.Footer.Exit == nil || *d.Footer.Exit != 2 {
+			t.Errorf("footer = %s", out)
+		}
+	})
+
+	t.Run("show json", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run(input)
+		id := extractID(out)
+
+		out, _, _ = env.run("", "show", id, "-l", "1-2", "-a", "2", "1", "-f", "ERROR", "--format", "json")
+		d := decode(t, out)
+		var got []string
+		for _, l := range d.Lines {
+			got = append(got, fmt.Sprintf("%d:%s", l.N, strings.Join(l.Reasons, ",")))
+		}
+		want := []string{"1:range,around", "2:range,around", "3:around", "31:filter"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("lines = %v, want %v", got, want)
+		}
+		if d.Footer.Command != "show" || d.Footer.ID != id || d.Footer.Total != 61 {
+			t.Errorf("footer = %+v", d.Footer)
+		}
+
+		out, _, _ = env.run("", "show", id, "--format", "json")
+		d = decode(t, out)
+		if len(d.Lines) != 61 || d.Lines[0].Reasons[0] != "all" {
+			t.Errorf("full show: %d lines, first %+v", len(d.Lines), d.Lines[0])
+		}
+	})
+
+	t.Run("list json", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run("", "list", "--format", "json")
+		assertContains(t, "empty", out, `^\{"version":1,"captures":\[\]\}\n$`)
+
+		out, _, _ = env.run(seqInput(5))
+		id := extractID(out)
+		out, _, _ = env.run("", "list", "--format", "jsonl")
+		assertContains(t, "capture record", out, `\{"type":"capture","id":"`+id+`","lines":5,`)
+	})
+
+	t.Run("bad format", func(t *testing.T) {
+		_, stderr, code := run(t, "x\n", "--format", "yaml")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "error", stderr, `--format must be text, json or jsonl`)
+	})
+}
+
+func TestGoTestSummary(t *testing.T) {
+	var b strings.Builder
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&b, "=== RUN   TestErrorCase%d\n--- PASS: TestErrorCase%d (0.00s)\n", i, i)
+	}
+	b.WriteString("=== RUN   TestParse\n" +
+		"    parse_test.go:42: got error \"unexpected EOF\", want nil\n" +
+		"--- FAIL: TestParse (0.01s)\n" +
+		"FAIL\n" +
+		"FAIL\texample.com/app/parse\t0.020s\n" +
+		"# example.com/app/cmd [example.com/app/cmd.test]\n" +
+		"cmd/main_test.go:7:2: undefined: run\n" +
+		"FAIL\texample.com/app/cmd [build failed]\n" +
+		"ok  \texample.com/app/util\t0.004s\n" +
+		"FAIL\n")
+	input := b.String()
+
+	t.Run("pipe", func(t *testing.T) {
+		out, _, _ := run(t, input, "--summary", "gotest")
+		assertContains(t, "test heading", out, `(?m)^## FAIL TestParse \(example.com/app/parse, 0.01s\) \| lines 82-83 \| at parse_test.go:42\n82:     parse_test.go:42: got error`)
+		assertContains(t, "build heading", out, `(?m)^## BUILD FAILED example.com/app/cmd \| lines 86-87 \| at cmd/main_test.go:7:2\n86: # example.com/app/cmd`)
+		assertContains(t, "footer", out, `showing 4 \| sections: 82-83, 86-87 \| packages: 1 ok, 1 failed, 1 build failed \| tests: 40 passed, 1 failed ---`)
+		assertNotContains(t, "no head", out, `TestErrorCase1 `)
+		assertNotContains(t, "no windows", out, `head: `)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, _, _ := run(t, input, "--summary", "gotest", "--format", "jsonl")
+		assertContains(t, "line record", out, `\{"type":"line","n":82,"text":"    parse_test.go:42: got error \\"unexpected EOF\\", want nil","reasons":\["summary"\]\}`)
+		assertContains(t, "summary", out, `"summary":\{"name":"gotest","counts":\{[^}]*"tests_failed":1[^}]*\},"items":\[\{"kind":"test","title":"FAIL TestParse \(example.com/app/parse, 0.01s\)","line":82,"end":83,"locations":\["parse_test.go:42"\]\}`)
+		assertNotContains(t, "no headings", out, `##`)
+	})
+
+	t.Run("run and show", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, code := env.run("", "run", "--summary", "gotest", "--", "sh", "-c", "echo '--- FAIL: TestX (0.00s)'; echo '    x_test.go:3: bad'; printf 'FAIL\\texample.com/x\\t0.1s\\n'; exit 1")
+		if code != 1 {
+			t.Errorf("exit code = %d, want 1", code)
+		}
+		assertContains(t, "run summary", out, `## FAIL TestX \(example.com/x, 0.00s\) \| lines 1-2 \| at x_test.go:3\n`)
+		assertContains(t, "run footer", out, `\| packages: 1 failed \| tests: 1 failed \| exit 1 \|`)
+
+		id := extractID(out)
+		out, _, _ = env.run("", "show", id, "--summary", "gotest")
+		assertContains(t, "show summary", out, `## FAIL TestX .*\n1: --- FAIL: TestX \(0.00s\)\n2:     x_test.go:3: bad\n--- glance show `+id+` \| 3 lines \| showing 2 \| sections: 1-2 \| packages: 1 failed \| tests: 1 failed ---`)
+	})
+
+	t.Run("no results", func(t *testing.T) {
+		out, _, _ := run(t, seqInput(5), "--summary", "gotest")
+		assertContains(t, "footer", out, `showing 0 \| sections:  \| no go test results found ---`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, stderr, code := run(t, "x\n", "--summary", "pytest")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "unknown", stderr, `unknown summary "pytest" \(available: .*gotest.*\)`)
+
+		_, stderr, _ = run(t, "x\n", "--summary", "gotest", "-p", "errors")
+		assertContains(t, "with filter", stderr, `--summary can't be combined with filters or --budget`)
+	})
+}
+
+func TestDiagnosticsSummary(t *testing.T) {
+	input := "# example.com/app\n" +
+		"./main.go:3:2: \"os\" imported and not used\n" +
+		"./main.go:10:5: undefined: run\n" +
+		"./main.go:3:2: \"os\" imported and not used\n" +
+		"util/x.go:8:1: missing return\n"
+
+	t.Run("pipe", func(t *testing.T) {
+		out, _, _ := run(t, input, "--summary", "diagnostics")
+		assertContains(t, "grouped", out, `## main.go \(2 errors\) \| lines 2-3\n2: 3:2   error  "os" imported and not used \(x2\)\n3: 10:5  error  undefined: run\n## util/x.go \(1 error\) \| line 5\n5: 8:1  error  missing return\n`)
+		assertContains(t, "footer", out, `\| diagnostics: 3 errors in 2 files, 1 repeat dropped ---`)
+	})
+
+	t.Run("show json", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run(input)
+		id := extractID(out)
+		out, _, _ = env.run("", "show", id, "--summary", "diagnostics", "--format", "json")
+		assertContains(t, "row", out, `\{"n":5,"text":"8:1  error  missing return","reasons":\["summary"\]\}`)
+		assertContains(t, "item", out, `\{"kind":"file","title":"util/x.go \(1 error\)","line":5,"end":5,"counts":\{"error":1\}\}`)
+	})
+}
+
+func TestTraces(t *testing.T) {
+	panicLines := "panic: runtime error: index out of range [5] with length 3\n" +
+		"\n" +
+		"goroutine 1 [running]:\n" +
+		"main.process(0xc000012345, 0x3)\n" +
+		"\t/app/main.go:42 +0x1d\n" +
+		"main.main()\n" +
+		"\t/app/main.go:10 +0x25\n" +
+		"exit status 2\n"
+	input := seqInput(20) + panicLines + seqInput(20) + strings.Replace(panicLines, "0xc000012345", "0xc000099999", 1) + seqInput(20)
+
+	t.Run("pipe", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "3", "-p", "errors", "--traces")
+		assertContains(t, "whole trace", out, `(?m)^21: panic: runtime error.*\n22: \n23: goroutine 1 \[running\]:\n24: main.process\(0xc000012345, 0x3\)\n25: \t/app/main.go:42 \+0x1d\n26: main.main\(\)\n27: \t/app/main.go:10 \+0x25\n49: panic: `)
+		assertNotContains(t, "repeat shown once", out, `(?m)^5[0-5]: `)
+		assertContains(t, "footer", out, `\| errors: 2 \(first 21, last 49\) \| traces: 21-27 x2 ---`)
+
+		out, _, _ = run(t, input, "-n", "3", "-p", "errors")
+		assertNotContains(t, "off by default", out, `main.process`)
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "3", "-p", "errors", "--trace-depth", "3")
+		assertContains(t, "truncated", out, `sections: 1-3, 21-23, 49, 74-76 \|`)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "3", "-p", "errors", "--traces", "--format", "jsonl")
+		assertContains(t, "trace reason", out, `\{"type":"line","n":23,"text":"goroutine 1 \[running\]:","reasons":\["trace"\]\}`)
+		assertContains(t, "filter reason", out, `"n":21,"text":"panic: [^"]*","reasons":\["filter"\],"filters":\["errors"\]`)
+		assertContains(t, "footer", out, `"traces":\[\{"line":21,"end":27,"count":2\}\]`)
+	})
+
+	t.Run("show", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run(input)
+		id := extractID(out)
+		out, _, _ = env.run("", "show", id, "-p", "errors", "--traces")
+		assertContains(t, "show", out, `showing 8 \| sections: 21-27, 49 \| errors: 2 \(first 21, last 49\) \| traces: 21-27 x2 ---`)
+	})
+
+	t.Run("bad depth", func(t *testing.T) {
+		_, stderr, code := run(t, "x\n", "--trace-depth", "0")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "error", stderr, `--trace-depth must be a positive integer`)
+	})
+}
+
+func TestGoroutineSummary(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("fatal error: all goroutines are asleep - deadlock!\n\ngoroutine 1 [semacquire]:\nsync.(*WaitGroup).Wait(0xc000012345)\n\t/usr/local/go/src/sync/waitgroup.go:118 +0x60\nmain.main()\n\t/app/main.go:20 +0x85\n")
+	for id := 2; id <= 201; id++ {
+		fmt.Fprintf(&b, "\ngoroutine %d [chan send]:\nmain.produce(0xc00%07x)\n\t/app/main.go:9 +0x2a\ncreated by main.main in goroutine 1\n\t/app/main.go:15 +0x45\n", id, id)
+	}
+	input := b.String()
+
+	env := newTestEnv(t)
+	out, _, _ := env.run(input, "--summary", "goroutines")
+	assertContains(t, "panicking goroutine", out, `(?m)^## PANIC in goroutine 1 \[semacquire\]: fatal error: all goroutines are asleep - deadlock! \| lines 1-7 \| at /usr/local/go/src/sync/waitgroup.go:118, /app/main.go:20\n1: fatal error`)
+	assertContains(t, "group", out, `(?m)^## 200 goroutines \[chan send\] in main.produce \| lines 9-13 \| at /app/main.go:9, /app/main.go:15\n9: goroutine 2 \[chan send\]:\n10: main.produce`)
+	assertContains(t, "footer", out, `\| goroutines: 201 in 2 distinct stacks \| states: 200 chan send, 1 semacquire \| panic in goroutine 1 ---`)
+
+	id := extractID(out)
+	out, _, _ = env.run("", "show", id, "--summary", "goroutines", "--format", "json")
+	assertContains(t, "show json", out, `"items":\[\{"kind":"panic",.*\{"kind":"goroutines","title":"200 goroutines \[chan send\] in main.produce","line":9,"end":13,"locations":\["/app/main.go:9","/app/main.go:15"\],"counts":\{"goroutines":200\}\}\]`)
+}
+
+func TestRecordStart(t *testing.T) {
+	var b strings.Builder
+	for i := 1; i <= 40; i++ {
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "2024-05-01T14:%02d:00Z ERROR request %d failed\n  caused by: timeout\n  SELECT * FROM users\n", i, i)
+			continue
+		}
+		fmt.Fprintf(&b, "2024-05-01T14:%02d:00Z INFO request %d ok\n", i, i)
+	}
+	input := b.String()
+	start := `^\d{4}-`
+
+	t.Run("whole records", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "2", "-f", "timeout", "--record-start", start)
+		assertContains(t, "record shown", out, `(?m)^10: 2024-05-01T14:10:00Z ERROR request 10 failed\n11:   caused by: timeout\n12:   SELECT \* FROM users\n`)
+		assertContains(t, "footer", out, `--- glance id=\S+ \| 48 lines \| 40 records \| showing 15 \| sections: 1-2, 10-12, 22-24, 34-36, 45-48 \| timeout: 4 \(first 10, last 46\) ---`)
+		assertContains(t, "tail is two records", out, `(?m)^45: .*request 39 ok\n46: .*request 40 failed\n`)
+	})
+
+	t.Run("context in records", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "1", "-f", "request 20 ", "-C", "1", "--record-start", start)
+		assertContains(t, "neighbouring records", out, `(?m)^21: .*request 19 ok\n22: .*request 20 failed\n23:   caused by: timeout\n24:   SELECT \* FROM users\n25: .*request 21 ok\n`)
+	})
+
+	t.Run("budget reveal", func(t *testing.T) {
+		out, _, _ := run(t, input, "-n", "1", "-f", "timeout", "--budget", "8", "--record-start", start)
+		assertContains(t, "reveal keeps records", out, `more matches hidden: glance show \S+ -f timeout --record-start '\^\\d\{4\}-'`)
+	})
+
+	t.Run("show", func(t *testing.T) {
+		env := newTestEnv(t)
+		out, _, _ := env.run(input)
+		id := extractID(out)
+		out, _, _ = env.run("", "show", id, "-f", "timeout", "--record-start", start)
+		assertContains(t, "show records", out, `(?m)^10: .*request 10 failed\n11:   caused by: timeout\n12:   SELECT`)
+		assertContains(t, "show footer", out, `\| 48 lines \| 40 records \| showing 12 \|`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, stderr, code := run(t, "x\n", "--record-start", "(")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "bad regex", stderr, `invalid regex`)
+		_, stderr, _ = run(t, "x\n", "--record-start", "^x", "--traces")
+		assertContains(t, "with traces", stderr, `--record-start can't be combined with --summary or --traces`)
+	})
+}
+
+func TestShowTimeRange(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&b, "2024-05-01T14:%02d:00Z INFO tick %d\n", i, i)
+		if i == 12 {
+			b.WriteString("  continued\n")
+		}
+	}
+	env := newTestEnv(t)
+	out, _, _ := env.run(b.String())
+	id := extractID(out)
+
+	t.Run("since and until", func(t *testing.T) {
+		out, _, _ := env.run("", "show", id, "--since", "14:11", "--until", "14:13")
+		assertContains(t, "range", out, `(?m)^12: .*tick 11\n13: .*tick 12\n14:   continued\n15: .*tick 13\n---`)
+		assertContains(t, "footer", out, `\| 21 lines \| showing 4 \| sections: 12-15 \| time: 2024-05-01T14:11:00Z to 2024-05-01T14:13:59Z ---`)
+	})
+
+	t.Run("until takes in the whole minute", func(t *testing.T) {
+		out, _, _ := env.run("2024-05-01T14:04:59Z a\n2024-05-01T14:05:01Z b\n2024-05-01T14:05:59Z c\n2024-05-01T14:06:00Z d\n")
+		out, _, _ = env.run("", "show", extractID(out), "--since", "14:05", "--until", "14:05")
+		assertContains(t, "minute", out, `(?m)^2: \S+ b\n3: \S+ c\n---`)
+	})
+
+	t.Run("last", func(t *testing.T) {
+		out, _, _ := env.run("", "show", id, "--last", "2m")
+		assertContains(t, "from the final timestamp", out, `showing 3 \| sections: 19-21 \| time: 2024-05-01T14:17:00Z to … ---`)
+	})
+
+	t.Run("ORs with lines and filters", func(t *testing.T) {
+		out, _, _ := env.run("", "show", id, "--last", "1m", "-l", "1-1", "-f", "tick 5$", "--format", "json")
+		assertContains(t, "reasons", out, `"n":20,"text":"[^"]*","reasons":\["time"\]`)
+		assertContains(t, "sections", out, `"sections":\[\[1,1\],\[6,6\],\[20,21\]\]`)
+		assertContains(t, "json time", out, `"time":\{"since":"2024-05-01T14:18:00Z"\}`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, stderr, code := env.run("", "show", id, "--since", "soon")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "bad time", stderr, `--since: invalid time "soon"`)
+		_, stderr, _ = env.run("", "show", id, "--last", "-5m")
+		assertContains(t, "bad duration", stderr, `--last must be a positive duration`)
+		_, stderr, _ = env.run("", "show", id, "--last", "5m", "--summary", "gotest")
+		assertContains(t, "with summary", stderr, `--summary can't be combined`)
+		out, _, _ := env.run("plain\nlines\n")
+		_, stderr, _ = env.run("", "show", extractID(out), "--last", "5m")
+		assertContains(t, "no timestamps", stderr, `no timestamps found in capture`)
+	})
+}
+
+func TestDiff(t *testing.T) {
+	env := newTestEnv(t)
+	run1 := "=== RUN TestA\n2024-05-01T14:00:00Z started pid 41 in /tmp/TestA123/001\nok   example.com/a 0.12s\nFAIL example.com/b 1.5s\n--- FAIL: TestB (0.01s)\n"
+	run2 := "=== RUN TestA\n2024-05-02T09:30:00Z started pid 977 in /tmp/TestA456/001\nok   example.com/a 0.3s\nok   example.com/b 2.1s\nok   example.com/c 0.2s\n"
+	out, _, _ := env.run(run1)
+	id1 := extractID(out)
+	out, _, _ = env.run(run2)
+	id2 := extractID(out)
+
+	t.Run("changed lines", func(t *testing.T) {
+		out, _, _ := env.run("", "diff", id1, id2)
+		assertContains(t, "removed and added", out, `(?m)^-4: FAIL example.com/b 1.5s\n-5: --- FAIL: TestB \(0.01s\)\n\+4: ok   example.com/b 2.1s\n\+5: ok   example.com/c 0.2s\n--- glance diff`)
+		assertNotContains(t, "volatile lines equal", out, `started|example.com/a`)
+		assertContains(t, "footer", out, `--- glance diff `+id1+` `+id2+` \| 5 lines vs 5 lines \| -2 \+2 in 1 hunk \| volatile tokens ignored ---`)
+	})
+
+	t.Run("exact", func(t *testing.T) {
+		out, _, _ := env.run("", "diff", id1, id2, "--exact")
+		assertContains(t, "volatile lines differ", out, `(?m)^-2: 2024-05-01T14:00:00Z started`)
+		assertContains(t, "footer", out, `\| -4 \+4 in 1 hunk ---`)
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		out, _, _ := env.run("", "diff", id1, id2, "--stat")
+		if strings.Count(out, "\n") != 1 {
+			t.Errorf("expected only the footer, got:\n%s", out)
+		}
+		assertContains(t, "hunks", out, `-2 \+2 in 1 hunk: -4-5 \+4-5 \|`)
+	})
+
+	t.Run("identical", func(t *testing.T) {
+		out, _, _ := env.run("", "diff", id1, id1)
+		assertContains(t, "no changes", out, `^--- glance diff \S+ \S+ \| 5 lines vs 5 lines \| no changes \|`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, stderr, code := env.run("", "diff", id1)
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "usage", stderr, `usage: glance diff <id1> <id2>`)
+		_, stderr, _ = env.run("", "diff", id1, "nope")
+		assertContains(t, "missing", stderr, `capture not found: nope`)
+		_, stderr, _ = env.run("", "diff", id1, id2, "--bogus")
+		assertContains(t, "flag", stderr, `glance diff: unknown flag: --bogus`)
+	})
+}
+
+func TestRerun(t *testing.T) {
+	env := newTestEnv(t)
+	work := t.TempDir()
+	state := filepath.Join(work, "state")
+	os.WriteFile(state, []byte("FAIL TestB\n"), 0o644)
+	script := `echo "started at $(date +%T.%N)"; seq 40; cat ` + state + `; grep -q FAIL ` + state + ` && exit 1; exit 0`
+	out, _, code := env.run("", "run", "-n", "2", "--", "sh", "-c", script)
+	if code != 1 {
+		t.Fatalf("exit code = %d, want 1", code)
+	}
+	id := extractID(out)
+	capturesDir := filepath.Join(env.cacheDir, "glance", "captures")
+
+	t.Run("records the command", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join(capturesDir, id+".meta.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]any
+		json.Unmarshal(data, &m)
+		cwd, _ := os.Getwd()
+		if m["dir"] != cwd || !reflect.DeepEqual(m["flags"], []any{"-n", "2"}) || !reflect.DeepEqual(m["command"], []any{"sh", "-c", script}) {
+			t.Errorf("meta = %s", data)
+		}
+	})
+
+	t.Run("new vs previous", func(t *testing.T) {
+		os.WriteFile(state, []byte("ok TestB\n"), 0o644)
+		out, _, code := env.run("", "rerun", id)
+		if code != 0 {
+			t.Errorf("exit code = %d, want 0", code)
+		}
+		newID := extractID(out)
+		if newID == "" || newID == id {
+			t.Fatalf("expected a new capture, got %q", newID)
+		}
+		assertContains(t, "same flags", out, `showing 4 \| sections: 1-2, 41-42 .*\| exit 0 \|`)
+		assertContains(t, "changes", out, `(?m)^## new vs previous `+id+`\n-42: FAIL TestB\n\+42: ok TestB\n--- glance rerun of `+id+` \| -1 \+1 in 1 hunk \| volatile tokens ignored ---\n$`)
+		data, _ := os.ReadFile(filepath.Join(capturesDir, newID+".meta.json"))
+		assertContains(t, "linked", string(data), `"previous":"`+id+`"`)
+	})
+
+	t.Run("json and extra flags", func(t *testing.T) {
+		out, _, _ := env.run("", "rerun", id, "--format", "json")
+		assertContains(t, "changes", out, `"changes":\{"previous":"`+id+`","removed":1,"added":1,"hunks":\[\{"a":42,"a_end":42,"b":42,"b_end":42\}\]\}`)
+		assertNotContains(t, "no text section", out, `## new vs previous`)
+	})
+
+	t.Run("cut short", func(t *testing.T) {
+		os.WriteFile(state, []byte(strings.Repeat("ok\n", 30)), 0o644)
+		out, _, _ := env.run("", "rerun", id)
+		assertContains(t, "hint", out, `\| -1 \+30 in 1 hunk \| volatile tokens ignored \| showing 20 of 31: glance diff `+id+` \S+ ---`)
+	})
+
+	t.Run("working directory", func(t *testing.T) {
+		os.WriteFile(filepath.Join(capturesDir, id+".meta.json"), []byte(`{"command":["cat","state"],"dir":"`+work+`"}`), 0o644)
+		out, _, _ := env.run("", "rerun", id)
+		assertContains(t, "ran in dir", out, `(?m)^1: ok$`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		out, _, _ := env.run("piped\n")
+		_, stderr, code := env.run("", "rerun", extractID(out))
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "pipe capture", stderr, `has no recorded command`)
+		_, stderr, _ = env.run("", "rerun")
+		assertContains(t, "usage", stderr, `usage: glance rerun <id>`)
+		_, stderr, _ = env.run("", "rerun", "nope")
+		assertContains(t, "missing", stderr, `capture not found: nope`)
+	})
+}
+
+func TestWatch(t *testing.T) {
+	env := newTestEnv(t)
+	counter := filepath.Join(t.TempDir(), "n")
+	os.WriteFile(counter, []byte("0"), 0o644)
+	// Counts its runs: the output is the same for runs 1-3, then changes,
+	// and says "ready" from run 5.
+	script := `n=$(($(cat ` + counter + `)+1)); echo $n > ` + counter + `; echo "at $(date +%T.%N)"; seq 3
+[ $n -ge 4 ] && echo "step $n"; [ $n -ge 5 ] && echo ready; exit 0`
+
+	t.Run("until a match", func(t *testing.T) {
+		out, _, code := env.run("", "watch", "--every", "10ms", "--until", "^ready$", "--timeout", "30s", "-n", "2", "--", "sh", "-c", script)
+		if code != 0 {
+			t.Errorf("exit code = %d, want 0", code)
+		}
+		assertContains(t, "first run summarized", out, `^1: at \S+\n2: 1\n3: 2\n4: 3\n--- glance id=\S+ \| 4 lines .*\| exit 0 \|`)
+		assertContains(t, "unchanged runs folded", out, `(?m)^## runs 2-3: no changes$`)
+		assertContains(t, "changed lines only", out, `(?m)^## run 4: \S+ \| exit 0 \| \S+ \| -0 \+1 in 1 hunk\n\+5: step 4\n## run 5: `)
+		assertContains(t, "stop reason", out, `--- glance watch \| last id=\S+ \| 5 runs \| stopped: run 5 matched "\^ready\$" on line 6 \| \S+ ---\n$`)
+
+		id := regexp.MustCompile(`last id=(\S+)`).FindStringSubmatch(out)[1]
+		show, _, _ := env.run("", "show", id)
+		assertContains(t, "each run stored", show, `step 5\nready\n$`)
+	})
+
+	t.Run("until exit", func(t *testing.T) {
+		os.WriteFile(counter, []byte("0"), 0o644)
+		out, _, code := env.run("", "watch", "--every", "10ms", "--until-exit", "0", "--", "sh", "-c", `n=$(($(cat `+counter+`)+1)); echo $n > `+counter+`; echo run; [ $n -ge 2 ]`)
+		if code != 0 {
+			t.Errorf("exit code = %d, want 0", code)
+		}
+		assertContains(t, "stopped", out, `\| 2 runs \| stopped: run 2 exited 0 \|`)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		out, _, code := env.run("", "watch", "--every", "10ms", "--until", "never", "--timeout", "300ms", "--", "sh", "-c", "echo same; sleep 10")
+		if code != 124 {
+			t.Errorf("exit code = %d, want 124", code)
+		}
+		assertContains(t, "killed", out, `signal killed`)
+		assertContains(t, "stopped", out, `\| 1 run \| stopped: timeout after 300ms \|`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, stderr, code := env.run("", "watch", "ls")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "usage", stderr, `glance watch: usage: glance watch`)
+		_, stderr, _ = env.run("", "watch", "--every", "0", "--", "ls")
+		assertContains(t, "bad every", stderr, `--every must be a positive duration`)
+	})
+}
+
+func TestBaseline(t *testing.T) {
+	env := newTestEnv(t)
+	good := "build started 12:00:01\nfoo.go:12:3: warning: deprecated call to Bar\nwarning: cache miss after 0.3s\nok\n"
+	out, _, _ := env.run(good)
+	goodID := extractID(out)
+	now := "build started 13:10:11\nfoo.go:40:3: warning: deprecated call to Bar\nwarning: cache miss after 1.2s\nbar.go:7:1: warning: shadowed variable\nerror: boom\nok\n"
+
+	t.Run("add and list", func(t *testing.T) {
+		out, _, code := env.run("", "baseline", "add", "proj", goodID)
+		if code != 0 {
+			t.Fatalf("exit code = %d", code)
+		}
+		assertContains(t, "added", out, `Added baseline: proj \(4 fingerprints, 4 new\)`)
+		out, _, _ = env.run("", "baseline", "add", "proj", goodID)
+		assertContains(t, "nothing new", out, `\(4 fingerprints, 0 new\)`)
+		out, _, _ = env.run("", "baseline", "list")
+		assertContains(t, "listed", out, `proj\s+4 fingerprints`)
+	})
+
+	t.Run("pipe", func(t *testing.T) {
+		out, _, _ := env.run(now, "-n", "1", "-p", "warnings", "-p", "errors", "--baseline", "proj")
+		assertContains(t, "new matches", out, `(?m)^4: bar.go:7:1: warning: shadowed variable\n5: error: boom\n`)
+		assertNotContains(t, "known warnings", out, `deprecated|cache miss`)
+		assertContains(t, "footer", out, `\| warnings: 1 \(line 4\) \| errors: 1 \(line 5\) \| baseline proj: 2 suppressed ---`)
+	})
+
+	t.Run("show and json", func(t *testing.T) {
+		out, _, _ := env.run(now, "-n", "1")
+		id := extractID(out)
+		out, _, _ = env.run("", "show", id, "-p", "warnings", "--baseline", "proj")
+		assertContains(t, "show footer", out, `\| showing 1 \| sections: 4 \| warnings: 1 \(line 4\) \| baseline proj: 2 suppressed ---`)
+		out, _, _ = env.run("", "show", id, "-p", "warnings", "--baseline", "proj", "--format", "json")
+		assertContains(t, "json", out, `"suppressed":2`)
+	})
+
+	t.Run("remove and errors", func(t *testing.T) {
+		_, stderr, code := env.run("x\n", "-p", "errors", "--baseline", "nope")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "unknown", stderr, `unknown baseline: nope`)
+		_, stderr, _ = env.run("", "baseline", "add", "../x", goodID)
+		assertContains(t, "bad name", stderr, `invalid baseline name`)
+		out, _, _ := env.run("", "baseline", "remove", "proj")
+		assertContains(t, "removed", out, `Removed baseline: proj`)
+		out, _, _ = env.run("", "baseline", "list")
+		assertContains(t, "none", out, `No baselines`)
+		_, stderr, _ = env.run("", "baseline", "remove", "proj")
+		assertContains(t, "gone", stderr, `baseline not found: proj`)
+	})
+}
+
+func TestNormalizeRules(t *testing.T) {
+	env := newTestEnv(t)
+
+	t.Run("builtin", func(t *testing.T) {
+		out, _, _ := env.run("", "normalize", "test", "2024-05-01T10:00:00Z req 3f2b1c9e-1111-2222-3333-444455556666 from 10.0.0.7:54321 in 12ms")
+		if want := "<time> req <uuid> from 10.0.0.7:<port> in <dur>\n"; out != want {
+			t.Errorf("normalized = %q, want %q", out, want)
+		}
+	})
+
+	a, _, _ := env.run("start\nhandled req-4f2a\nend\n")
+	b, _, _ := env.run("start\nhandled req-9c01\nend\n")
+	idA, idB := extractID(a), extractID(b)
+
+	t.Run("user rule", func(t *testing.T) {
+		out, _, _ := env.run("", "diff", idA, idB, "--stat")
+		assertContains(t, "differs before", out, `-1 \+1 in 1 hunk`)
+		out, _, code := env.run("", "normalize", "add", "reqid", `req-[0-9a-f]+`)
+		if code != 0 {
+			t.Fatalf("exit code = %d", code)
+		}
+		assertContains(t, "added", out, `Added rule: reqid`)
+		out, _, _ = env.run("req-1 and req-2\nplain\n", "normalize", "test")
+		if want := "<reqid> and <reqid>\nplain\n"; out != want {
+			t.Errorf("stdin normalized = %q, want %q", out, want)
+		}
+		out, _, _ = env.run("", "diff", idA, idB, "--stat")
+		assertContains(t, "same after", out, `no changes`)
+		out, _, _ = env.run("", "normalize", "list")
+		assertContains(t, "listed", out, `(?s)Built-in rules:.*uuid.*User rules.*reqid\s+<reqid>\s+req-`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, stderr, code := env.run("", "normalize", "add", "bad", "(")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "bad regex", stderr, `invalid regex`)
+		_, stderr, _ = env.run("", "normalize", "add", "time", "x")
+		assertContains(t, "builtin", stderr, `cannot override built-in rule: time`)
+		_, stderr, _ = env.run("", "normalize", "remove", "uuid")
+		assertContains(t, "builtin remove", stderr, `cannot remove built-in rule: uuid`)
+		out, _, _ := env.run("", "normalize", "remove", "reqid")
+		assertContains(t, "removed", out, `Removed rule: reqid`)
+		_, stderr, _ = env.run("", "normalize", "remove", "reqid")
+		assertContains(t, "gone", stderr, `rule not found: reqid`)
+	})
+}
+
+func TestCaptureMetadata(t *testing.T) {
+	env := newTestEnv(t)
+	capturesDir := filepath.Join(env.cacheDir, "glance", "captures")
+	out, _, _ := env.run("ok\nerror: boom\n", "--label", "nightly", "-p", "errors")
+	pipeID := extractID(out)
+	out, _, _ = env.run("", "run", "--", "sh", "-c", "echo hi; exit 3")
+	runID := extractID(out)
+
+	t.Run("recorded", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join(capturesDir, pipeID+".meta.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]any
+		json.Unmarshal(data, &m)
+		cwd, _ := os.Getwd()
+		if m["lines"] != 2.0 || m["bytes"] != 15.0 || m["label"] != "nightly" || m["dir"] != cwd ||
+			!reflect.DeepEqual(m["filters"], []any{"-p", "errors"}) || m["created"] == nil {
+			t.Errorf("meta = %s", data)
+		}
+		data, _ = os.ReadFile(filepath.Join(capturesDir, runID+".meta.json"))
+		assertContains(t, "run exit", string(data), `"command":\["sh","-c","echo hi; exit 3"\].*"exit":3`)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		out, _, _ := env.run("", "list")
+		assertContains(t, "label", out, `(?m)^`+pipeID+`\t2 lines\t\S+.*\tnightly$`)
+		assertContains(t, "command", out, `(?m)^`+runID+`\t1 lines\t.*\tsh -c 'echo hi; exit 3' \(exit 3\)$`)
+		out, _, _ = env.run("", "list", "--format", "jsonl")
+		assertContains(t, "json", out, `"id":"`+pipeID+`","lines":2,.*"bytes":15,.*"label":"nightly"`)
+	})
+
+	t.Run("show info", func(t *testing.T) {
+		out, _, _ := env.run("", "show", runID, "--info")
+		assertContains(t, "fields", out, `(?m)^lines\s+1\nbytes\s+3\ncommand\s+sh -c 'echo hi; exit 3'\nexit\s+3\n`)
+		assertNotContains(t, "recorded", out, `no metadata`)
+		out, _, _ = env.run("", "show", pipeID, "--info", "--format", "json")
+		assertContains(t, "json", out, `^\{"version":1,"capture":\{"id":"`+pipeID+`","lines":2,`)
+	})
+
+	t.Run("older capture", func(t *testing.T) {
+		os.Remove(filepath.Join(capturesDir, pipeID+".meta.json"))
+		out, _, _ := env.run("", "list")
+		assertContains(t, "counted", out, `(?m)^`+pipeID+`\t2 lines\t\S+$`)
+		out, _, _ = env.run("", "show", pipeID, "--info")
+		assertContains(t, "fallback", out, `(?m)^lines\s+2\nbytes\s+15\n\(no metadata recorded`)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, stderr, code := env.run("x\n", "--label", "x", "--no-store")
+		if code == 0 {
+			t.Error("expected non-zero exit")
+		}
+		assertContains(t, "no store", stderr, `--label can't be combined with --no-store`)
+		_, stderr, _ = env.run("", "show", runID, "--info", "-f", "x")
+		assertContains(t, "info flags", stderr, `--info can only be combined with --format`)
+	})
+}
+
 func TestPresetsEdgeCases(t *testing.T) {
 	t.Run("no subcommand", func(t *testing.T) {
 		_, stderr, _ := run(t, "", "presets")
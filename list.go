@@ -1,15 +1,66 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 )
 
-func doList() {
+func parseListArgs(args []string) (outputFormat, error) {
+	format := formatText
+	i := 0
+	for i < len(args) {
+		switch args[i] {
+		case "--format":
+			f, err := parseFormatName(consumeFlag(args, &i, "--format"))
+			if err != nil {
+				return format, err
+			}
+			format = f
+		default:
+			return format, fmt.Errorf("unknown flag: %s", args[i])
+		}
+	}
+	return format, nil
+}
+
+// jsonCapture describes a stored capture in JSON list output.
+type jsonCapture struct {
+	Type       string `json:"type,omitempty"`
+	ID         string `json:"id"`
+	Lines      int    `json:"lines"`
+	Modified   string `json:"modified,omitempty"`
+	AgeSeconds int64  `json:"age_seconds"`
+
+	// From the capture's metadata, when it has any.
+	Bytes    int64    `json:"bytes,omitempty"`
+	Dir      string   `json:"dir,omitempty"`
+	Filters  []string `json:"filters,omitempty"`
+	Label    string   `json:"label,omitempty"`
+	Command  []string `json:"command,omitempty"`
+	Exit     *int     `json:"exit,omitempty"`
+	Signal   string   `json:"signal,omitempty"`
+	Previous string   `json:"previous,omitempty"`
+
+	created time.Time
+	// recorded is false when the counts and time come from the file.
+	recorded bool
+}
+
+type jsonCaptureList struct {
+	Version  int           `json:"version"`
+	Captures []jsonCapture `json:"captures"`
+}
+
+func doList(args []string) {
+	format, err := parseListArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glance list: %s\n", err)
+		os.Exit(1)
+	}
 	if err := ensureCacheDir(); err != nil {
 		fatal(err.Error())
 	}
@@ -24,27 +75,65 @@ func doList() {
 		return entries[i].Name() < entries[j].Name()
 	})
 
+	bw := bufio.NewWriter(os.Stdout)
+	defer bw.Flush()
+	if format == formatJSONL {
+		writeJSON(bw, jsonHeader{Type: "header", Version: jsonSchemaVersion})
+	}
+	captures := []jsonCapture{}
 	found := false
 	now := time.Now()
 	for _, e := range entries {
 		if e.IsDir() || !strings.HasSuffix(e.Name(), ".txt") {
 			continue
 		}
-		found = true
 		id := strings.TrimSuffix(e.Name(), ".txt")
-		path := filepath.Join(cacheDir(), e.Name())
-		lines := countLines(path)
-		info, err := e.Info()
-		ageStr := "unknown"
-		if err == nil {
-			secs := int64(now.Sub(info.ModTime()).Seconds())
-			ageStr = formatAge(secs)
+		c, err := captureInfo(id, now)
+		if err != nil {
+			continue
+		}
+		found = true
+		switch format {
+		case formatJSON:
+			captures = append(captures, c)
+		case formatJSONL:
+			c.Type = "capture"
+			writeJSON(bw, c)
+		default:
+			fmt.Fprintf(bw, "%s\t%d lines\t%s", id, c.Lines, formatAge(c.AgeSeconds))
+			if d := c.describe(); d != "" {
+				fmt.Fprintf(bw, "\t%s", d)
+			}
+			fmt.Fprintln(bw)
 		}
-		fmt.Printf("%s\t%d lines\t%s\n", id, lines, ageStr)
 	}
-	if !found {
-		fmt.Println("No stored captures.")
+	switch {
+	case format == formatJSON:
+		writeJSON(bw, jsonCaptureList{Version: jsonSchemaVersion, Captures: captures})
+	case !found && format == formatText:
+		fmt.Fprintln(bw, "No stored captures.")
+	}
+}
+
+// describe is the capture's label and command, like
+// "nightly: go test ./... (exit 1)", or "" if it has neither.
+func (c jsonCapture) describe() string {
+	var cmd string
+	switch {
+	case c.Signal != "":
+		cmd = fmt.Sprintf("%s (signal %s)", shellJoin(c.Command), c.Signal)
+	case c.Exit != nil:
+		cmd = fmt.Sprintf("%s (exit %d)", shellJoin(c.Command), *c.Exit)
+	case len(c.Command) > 0:
+		cmd = shellJoin(c.Command)
+	}
+	switch {
+	case c.Label != "" && cmd != "":
+		return c.Label + ": " + cmd
+	case c.Label != "":
+		return c.Label
 	}
+	return cmd
 }
 
 func countLines(path string) int {
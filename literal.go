@@ -0,0 +1,204 @@
+package main
+
+// literalSetMin is how many literal filters it takes before they are
+// matched together in one pass instead of one regex each.
+const literalSetMin = 3
+
+// literalPattern is one fixed-string filter in a literalSet.
+type literalPattern struct {
+	name  string
+	text  string
+	icase bool
+	word  bool
+}
+
+// literalSet matches many fixed strings in a single scan of each line using
+// Aho-Corasick automatons, one for case-sensitive patterns and one for
+// ASCII case-insensitive ones, so cost doesn't grow with the filter count.
+type literalSet struct {
+	patterns []literalPattern
+	exact    *acAutomaton
+	folded   *acAutomaton
+	// seen marks the patterns found in the line being scanned, and found
+	// lists them so only those are cleared for the next line.
+	seen  []bool
+	found []int
+	// lower holds the line being scanned for case-insensitive patterns,
+	// lowercased, reused from line to line.
+	lower []byte
+}
+
+func newLiteralSet(patterns []literalPattern) *literalSet {
+	ls := &literalSet{patterns: patterns, exact: newACAutomaton(), folded: newACAutomaton(), seen: make([]bool, len(patterns))}
+	for i, p := range patterns {
+		if p.icase {
+			ls.folded.add(string(foldASCII(nil, p.text)), i)
+		} else {
+			ls.exact.add(p.text, i)
+		}
+	}
+	ls.exact.build()
+	ls.folded.build()
+	return ls
+}
+
+// each calls fn with the index of every pattern found in s, once per
+// pattern, stopping early if fn returns false. fn must not call each.
+func (ls *literalSet) each(s string, fn func(i int) bool) {
+	defer func() {
+		for _, p := range ls.found {
+			ls.seen[p] = false
+		}
+		ls.found = ls.found[:0]
+	}()
+	visit := func(p, end int) bool {
+		if ls.seen[p] {
+			return true
+		}
+		pat := ls.patterns[p]
+		if pat.word && !wordBounded(s, end-len(pat.text), end) {
+			return true
+		}
+		ls.seen[p] = true
+		ls.found = append(ls.found, p)
+		return fn(p)
+	}
+	if !ls.exact.empty() && !acScan(ls.exact, s, visit) {
+		return
+	}
+	if !ls.folded.empty() {
+		ls.lower = foldASCII(ls.lower[:0], s)
+		acScan(ls.folded, ls.lower, visit)
+	}
+}
+
+func (ls *literalSet) match(s string) bool {
+	found := false
+	ls.each(s, func(int) bool {
+		found = true
+		return false
+	})
+	return found
+}
+
+// foldASCII appends s to dst with ASCII letters lowercased, so byte offsets
+// are unchanged.
+func foldASCII(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		dst = append(dst, c)
+	}
+	return dst
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// wordBounded reports whether s[start:end] is not part of a longer word.
+func wordBounded(s string, start, end int) bool {
+	if start > 0 && isWordByte(s[start-1]) {
+		return false
+	}
+	return end >= len(s) || !isWordByte(s[end])
+}
+
+type acNode struct {
+	next map[byte]int
+	fail int
+	// out lists the patterns ending here, including via fail links.
+	out []int
+}
+
+type acAutomaton struct {
+	nodes    []acNode
+	patterns int
+}
+
+func newACAutomaton() *acAutomaton {
+	return &acAutomaton{nodes: []acNode{{next: map[byte]int{}}}}
+}
+
+func (ac *acAutomaton) empty() bool { return ac.patterns == 0 }
+
+func (ac *acAutomaton) add(text string, id int) {
+	n := 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		next, ok := ac.nodes[n].next[c]
+		if !ok {
+			next = len(ac.nodes)
+			ac.nodes = append(ac.nodes, acNode{next: map[byte]int{}})
+			ac.nodes[n].next[c] = next
+		}
+		n = next
+	}
+	ac.nodes[n].out = append(ac.nodes[n].out, id)
+	ac.patterns++
+}
+
+// build computes fail links breadth first.
+func (ac *acAutomaton) build() {
+	var queue []int
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for c, child := range ac.nodes[n].next {
+			f := ac.nodes[n].fail
+			for {
+				if next, ok := ac.nodes[f].next[c]; ok && next != child {
+					ac.nodes[child].fail = next
+					break
+				}
+				if f == 0 {
+					break
+				}
+				f = ac.nodes[f].fail
+			}
+			fail := ac.nodes[child].fail
+			ac.nodes[child].out = append(ac.nodes[child].out, ac.nodes[fail].out...)
+			queue = append(queue, child)
+		}
+	}
+}
+
+// acScan calls fn for each pattern occurrence in s with its end offset,
+// stopping early if fn returns false. It returns false if stopped early.
+// s is a line or a buffer holding one, so neither needs converting.
+func acScan[T string | []byte](ac *acAutomaton, s T, fn func(id, end int) bool) bool {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		for {
+			if next, ok := ac.nodes[n].next[c]; ok {
+				n = next
+				break
+			}
+			if n == 0 {
+				break
+			}
+			n = ac.nodes[n].fail
+		}
+		for _, id := range ac.nodes[n].out {
+			if !fn(id, i+1) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// parseLogfmt decodes a logfmt line such as
+//
+//	level=warn msg="slow query" dur=2.3s cached
+//
+// into a record. Quoted values use Go string escapes. A key without a
+// value, like cached, is true; key= is the empty string. So that prose
+// ending in a pair, like "ERROR connecting to db host=x", isn't taken for
+// logfmt, a line must start with a key=value pair, most of its tokens
+// must be pairs and nothing may be neither a pair nor a key.
+func parseLogfmt(s string) (map[string]any, bool) {
+	rec := make(map[string]any)
+	pairs, bare := 0, 0
+	i := 0
+	for {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i == len(s) {
+			break
+		}
+		start := i
+		for i < len(s) && s[i] > ' ' && s[i] != '=' && s[i] != '"' {
+			i++
+		}
+		key := s[start:i]
+		if key == "" {
+			return nil, false
+		}
+		if i == len(s) || s[i] == ' ' {
+			if pairs == 0 {
+				return nil, false
+			}
+			rec[key] = true
+			bare++
+			continue
+		}
+		if s[i] != '=' {
+			return nil, false
+		}
+		i++
+		pairs++
+		if i < len(s) && s[i] == '"' {
+			end := quotedEnd(s, i)
+			if end < 0 {
+				return nil, false
+			}
+			v, err := strconv.Unquote(s[i:end])
+			if err != nil {
+				return nil, false
+			}
+			rec[key] = v
+			i = end
+		} else {
+			start = i
+			for i < len(s) && s[i] > ' ' {
+				if s[i] == '"' {
+					return nil, false
+				}
+				i++
+			}
+			rec[key] = s[start:i]
+		}
+		if i < len(s) && s[i] != ' ' {
+			return nil, false
+		}
+	}
+	return rec, pairs > bare
+}
+
+// quotedEnd returns the offset just past the string starting with the
+// quote at s[start], or -1 if it isn't closed.
+func quotedEnd(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// formatLogfmt writes the given fields of rec as logfmt, quoting values
+// that need it.
+func formatLogfmt(rec map[string]any, fields []string) string {
+	var parts []string
+	for _, f := range fields {
+		v, ok := lookupField(rec, f)
+		if !ok {
+			continue
+		}
+		if v == true {
+			parts = append(parts, f)
+			continue
+		}
+		parts = append(parts, f+"="+logfmtValue(fieldString(v)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\\") || strings.IndexFunc(v, func(r rune) bool { return r < ' ' }) >= 0 {
+		return strconv.Quote(v)
+	}
+	return v
+}
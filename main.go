@@ -43,12 +43,26 @@ func main() {
 		doHelp(args[1:])
 	case "show":
 		doShow(args[1:])
+	case "run":
+		doRun(args[1:])
+	case "rerun":
+		doRerun(args[1:])
+	case "watch":
+		doWatch(args[1:])
+	case "clusters":
+		doClusters(args[1:])
+	case "diff":
+		doDiff(args[1:])
 	case "list":
-		doList()
+		doList(args[1:])
 	case "clean":
 		doClean(args[1:])
 	case "presets":
 		doPresets(args[1:])
+	case "baseline":
+		doBaseline(args[1:])
+	case "normalize":
+		doNormalize(args[1:])
 	default:
 		if len(args[0]) > 0 && args[0][0] == '-' {
 			// Pipe mode with flags
@@ -73,15 +87,164 @@ Usage:
   glance show <id> -f regex           Filter within stored output
   glance show <id> -p errors          Filter with preset
   glance show <id> -a 247 5           5 lines context around line 247
+  glance show <id> --last 5m          Last 5 minutes of a timestamped log
+  glance show <id> --info             When, where and how it was captured
 
 Flags:
   -l, --lines N-M      Line range
   -f, --filter REGEX   Filter pattern (repeatable, OR)
   -p, --preset NAME    Preset filter (repeatable, OR)
+  -q, --query QUERY    Boolean query over regexes and presets (see below)
+  -F, -w, -i           Fixed-string, whole-word, case-insensitive -f/-x
+                       patterns; -fF, -fw, -fi (combinable) for one filter
+  -x, --exclude REGEX  Drop filter matches matching REGEX (repeatable)
+  -X, --exclude-preset NAME
+                       Drop filter matches matching a preset (repeatable)
+  --baseline NAME      Drop filter matches seen in a baseline (repeatable)
   -a, --around N [C]   Context around line N (default C=5)
+  --since T, --until T Lines timestamped from/until T (inclusive)
+  --last DURATION      Lines in the last DURATION (e.g. 5m, 1h30m) before
+                       the capture's final timestamp
+  --collapse           Fold runs of identical consecutive lines
+  --collapse-similar   Also fold lines equal once normalized and with
+                       numbers masked
+  --format FORMAT      text (default), json or jsonl; see "glance help"
+  --where COND         Condition on JSON or logfmt lines (repeatable,
+                       AND), e.g. level=error or 'status>=500'; see
+                       "glance help"
+  --fields A,B         Print only these fields of JSON or logfmt lines
+  --json, --logfmt     Declare the input format; count lines not in it
+  --traces, --trace-depth N
+                       Show whole stack traces around filter matches
+  --record-start REGEX Filter whole multi-line records starting at REGEX
+  --summary NAME       gotest, diagnostics or goroutines; see "glance help"
+  --info               Print the capture's metadata: created, lines,
+                       bytes, label, command and exit, directory and
+                       filters (only with --format)
+
+With only --collapse, --collapse-similar or --fields, every line is shown.
+-l, -a, filters and time ranges OR together.
+
+Timestamps are read from the start of each line: RFC 3339 (also with a
+space instead of T, bracketed or as ts=/time=), syslog (May  1 14:02:03),
+common log format ([10/Oct/2000:13:55:36 -0700] after the host) and Unix
+seconds or milliseconds. Lines without one take the previous line's. T
+is a time of day (14:02, taken on the date of the first timestamp), a
+date and time (2024-05-01 14:02), a date or any of those formats.
+--until takes in all of the minute or day it names, so --until 14:05
+keeps lines up to 14:05:59.
+
+Queries combine /regex/ (or /regex/i), preset names, AND, OR, NOT and
+parentheses; NOT binds tightest, then AND, then OR:
+
+  glance show <id> -q 'errors AND /db/ AND NOT /timeout/i'
 
 The <id> is the full ID shown in the glance footer when piping output.
 Exact match required — use "glance list" to see all stored captures.
+`)
+			return
+		case "run":
+			fmt.Print(`glance run — run a command and summarize its output
+
+Usage:
+  glance run [flags] -- <command> [args...]
+  glance run <command> [args...]
+
+Runs the command with stdout and stderr merged (like 2>&1), summarizes
+the output exactly like pipe mode and adds the exit status and wall time
+to the footer. glance exits with the command's exit code (128+N if it
+was killed by signal N). The command, its working directory and the
+glance flags are stored with the capture for "glance rerun".
+
+Glance flags go first and end at "--". Without flags, every argument
+belongs to the command, so glance run go test ./... -- -v passes the
+"--" on to go test.
+
+Flags:
+  All pipe mode flags (-n, -f, -p, --no-store), plus:
+  --tag-stderr         Prefix stderr lines with "[stderr] "
+`)
+			return
+		case "rerun":
+			fmt.Print(`glance rerun — run a captured command again and compare
+
+Usage:
+  glance rerun <id> [flags]
+
+Runs the command of a "glance run" capture again, in the same directory
+and with the same glance flags plus any given here, and stores the
+output as a new capture linked to the old one. After the usual summary
+and footer, a "new vs previous" section lists up to 20 lines that
+appeared (+N) or disappeared (-N), compared after normalizing (see
+glance help normalize); "glance diff" shows them all. With
+--format json or jsonl, the footer has them as changes instead.
+`)
+			return
+		case "watch":
+			fmt.Print(`glance watch — rerun a command until something happens
+
+Usage:
+  glance watch [flags] -- <command> [args...]
+  glance watch --every 5s --until 'successfully rolled out' -- \
+      kubectl rollout status deploy/api
+  glance watch --until-exit 0 --timeout 5m -- go test -run TestFlaky
+
+Runs the command every --every until its output matches --until, it
+exits with --until-exit, or --timeout runs out, storing each run as a
+capture. The first run is summarized like glance run; after that only
+the lines that appeared (+N) or disappeared (-N) since the previous run
+are printed (up to 20 per run), and runs that changed nothing are
+folded into one line. The footer gives the last capture's ID and why
+watching stopped.
+
+glance exits 0 once a condition is met, 124 if the timeout ran out
+first (or the last run's exit code when no condition was given) and 130
+if interrupted. A run still going at the timeout is killed.
+
+Flags:
+  --every D            Time between runs (default 5s)
+  --until REGEX        Stop once a line of the output matches REGEX
+  --until-exit CODE    Stop once the command exits with CODE
+  --timeout D          Give up after D (default 10m)
+  All glance run flags except --no-store and --format, for the first run
+`)
+			return
+		case "clusters":
+			fmt.Print(`glance clusters — group a stored capture into message templates
+
+Usage:
+  glance clusters <id>
+  glance clusters <id> --sim 0.6 --rare 3
+
+Each line is turned into a template with its variable parts (any token
+containing a digit, or tokens that differ between similar lines) masked
+as <*>. Templates are printed with their count and first/last line
+numbers, most frequent first, plus one example line when something was
+masked. Rare templates are marked with ! — they are usually the
+interesting ones.
+
+Flags:
+  --sim F      Similarity needed to join a template, 0-1 (default 0.5)
+  --rare N     Mark templates seen at most N times (default 2)
+`)
+			return
+		case "diff":
+			fmt.Print(`glance diff — compare two stored captures
+
+Usage:
+  glance diff <id1> <id2>
+  glance diff <id1> <id2> --stat
+
+Prints the lines removed from the first capture as "-N: text" and the
+lines added in the second as "+N: text", N being the line number in
+each capture; unchanged lines are left out. Lines are normalized before
+comparing (see glance help normalize), so timestamps, UUIDs, durations,
+PIDs, ports, hex addresses and temp directories are ignored and two runs
+of the same command only differ where their output really does.
+
+Flags:
+  --exact      Compare lines as they are
+  --stat       Print only the footer, with the changed line ranges
 `)
 			return
 		case "list":
@@ -89,8 +252,14 @@ Exact match required — use "glance list" to see all stored captures.
 
 Usage:
   glance list
+  glance list --format json|jsonl
 
-Displays each capture's ID, line count, and age.
+Displays each capture's ID, line count, age, and label and command when
+it has them. JSON output gives each capture's id, lines, modified (RFC
+3339) and age_seconds, plus bytes, dir, filters, label, command, exit,
+signal and previous when recorded. These come from the <id>.meta.json
+file stored with each capture; captures from before glance wrote it are
+counted instead.
 `)
 			return
 		case "clean":
@@ -98,7 +267,8 @@ Displays each capture's ID, line count, and age.
 
 Usage:
   glance clean          Remove all stored captures
-  glance clean --all    Also remove user presets
+  glance clean --all    Also remove user presets, normalize rules and
+                        baselines
 `)
 			return
 		case "presets":
@@ -107,15 +277,65 @@ Usage:
 Usage:
   glance presets list                        Show all presets
   glance presets add <name> <regex> [desc]   Add user preset
+  glance presets add -x <exclude> <name> <regex> [desc]
+                                             Add user preset with exclusions
   glance presets remove <name>               Remove user preset
 
 Built-in presets cannot be removed or overridden.
 Use (?i) prefix in regex for case-insensitive matching:
 
   glance presets add deploys '(?i)deploy|release|rollout' 'Deployment events'
+
+A preset's exclusions only apply to that preset's own matches:
+
+  glance presets add -x 'healthz' http 'HTTP [45][0-9][0-9]' 'HTTP failures'
 `)
 			fmt.Printf("User presets are stored in %s\n", configPath())
 			return
+		case "normalize":
+			fmt.Print(`glance normalize — rules that mask what differs between runs
+
+Usage:
+  glance normalize list                           Show rules
+  glance normalize add <name> <regex> [repl]      Add user rule
+  glance normalize remove <name>                  Remove user rule
+  glance normalize test [line...]                 Print lines normalized
+
+Before comparing lines, diff, rerun, watch, --collapse-similar and
+baselines replace tokens that change from run to run with placeholders:
+timestamps, UUIDs, durations, PIDs, ports, hex addresses and temp
+directories. User rules run before the built-in ones, each replacing
+matches of its regex with repl (default <name>, and $1 refers to a
+group). test prints what its arguments, or each line of stdin,
+normalize to:
+
+  glance normalize add reqid 'req-[0-9a-f]+'
+  glance normalize test 'req-4f2a done in 12ms'    # <reqid> done in <dur>
+`)
+			fmt.Printf("User rules are stored in %s\n", normalizePath())
+			return
+		case "baseline":
+			fmt.Print(`glance baseline — suppress known noise learned from good captures
+
+Usage:
+  glance baseline add <name> <id> [id...]    Add captures' lines to a baseline
+  glance baseline list                       Show baselines
+  glance baseline remove <name>              Remove a baseline
+
+A baseline is the set of lines in known-good captures, each turned into
+a fingerprint: normalized (see glance help normalize) and with all
+other numbers masked, so a warning still matches when the line it
+points at moves. With --baseline NAME, pipe and
+show drop filter matches whose fingerprint is in the baseline, so only
+new warnings and errors are shown, and the footer says how many were
+suppressed:
+
+  go build ./... 2>&1 | glance                  # a clean build: id=X
+  glance baseline add myproj X
+  go build ./... 2>&1 | glance -p warnings --baseline myproj
+`)
+			fmt.Printf("Baselines are stored in %s\n", baselineDir())
+			return
 		}
 	}
 
@@ -127,29 +347,181 @@ lines plus regex-matched lines, with an ID to drill into full output.
 PIPE MODE:
   command | glance                  Head 10 + tail 10
   command | glance -n 5             Head 5 + tail 5
+  command | glance --head 0 --tail 50
+                                    Last 50 lines only
   command | glance -f 'ERROR|WARN'  + regex filter matches
   command | glance -p errors        + preset filter
+  command | glance -p errors -C 3   + 3 lines of context around matches
+  command | glance -F -f 'a.b[0]' -f 'github.com/x/y'
+                                    + literal (unescaped) filters
+  command | glance -p errors -x 'retrying'
+                                    + preset filter, minus known noise
+  command | glance -p errors --budget 40
+                                    Cap output at 40 lines, sampling matches
+  command | glance --where level=error --fields ts,msg
+                                    Error records from JSON or logfmt
+                                    logs, trimmed to two fields
+  go test ./... | glance --summary gotest
+                                    Failed tests and builds only
   command | glance --no-store       Don't store, no ID
+  command | glance --label nightly  Label the capture in glance list
 
 PIPE FLAGS:
-  -n, --head N       Head/tail line count (default: 10)
+  -n, --lines N      Head and tail line count (default: 10)
+  --head N           Head line count; 0 shows no head
+  --tail N           Tail line count; 0 shows no tail
   -f, --filter REGEX Additional middle-line filter (repeatable, OR)
   -p, --preset NAME  Named preset filter (repeatable, OR)
+  -q, --query QUERY  Boolean query, OR'd with other filters, e.g.
+                     'errors AND /db/ AND NOT /timeout/i'. Terms are
+                     /regex/ (suffix i ignores case) or preset names,
+                     combined with AND, OR, NOT and parentheses.
+  -F, --fixed-strings
+                     Treat -f and -x patterns as literal strings
+  -w, --word         Only match -f and -x patterns as whole words
+  -i, --ignore-case  Match -f and -x patterns ignoring case
+  -fF, -fw, -fi PAT  Same modes for a single filter; letters combine,
+                     e.g. -fFi 'a.b[0]'
+  -x, --exclude REGEX
+                     Drop filter matches matching REGEX (repeatable).
+                     Applied after all filters; head/tail are unaffected.
+  -X, --exclude-preset NAME
+                     Drop filter matches matching a preset (repeatable)
+  --baseline NAME    Drop filter matches also found in the known-good
+                     captures of a baseline (see glance help baseline)
+  -C, --context N    Lines of context before and after each match
+  -B, --before-context N
+                     Lines of context before each match
+  -A, --after-context N
+                     Lines of context after each match
+  --budget N|Nt      Cap output at N lines or about N tokens. Head and tail
+                     are always shown and count first; middle matches share
+                     what is left, keeping the first and last few and
+                     sampling the rest evenly. The footer reports how many
+                     were hidden and the glance show command to see them.
+                     Middle lines are held until the input ends, thinned
+                     to a few budgets' worth as they arrive.
+  --collapse         Fold runs of identical consecutive lines into one
+                     "120-480: (x361) text" line
+  --collapse-similar Also fold lines equal once normalized (see glance
+                     help normalize) and with numbers masked
+  --format FORMAT    text (default), json or jsonl
+  --traces           Show the whole stack trace (Go panic, Java exception,
+                     Python traceback) around a filter match in one, up to
+                     30 lines. A trace seen before shows only its first
+                     line; the footer counts each: "traces: 120-139 x5"
+  --trace-depth N    Like --traces, showing up to N lines of each trace
+  --record-start REGEX
+                     Treat each line matching REGEX and the lines after it,
+                     up to the next match, as one record, e.g. '^\d{4}-' for
+                     entries that start with a date. Head, tail, context
+                     and --budget then count records, and a filter match
+                     anywhere in a record shows all of it. Lines keep
+                     their own numbers; the footer adds "N records".
+  --summary NAME     Replace head/tail with a summary (see SUMMARIES)
   --no-store         Don't store capture, no ID issued
+  --label TEXT       Record TEXT with the capture, shown by glance list
+                     and glance show --info
+
+STRUCTURED LOGS (JSON LINES AND LOGFMT):
+  --where COND       Select records by field (repeatable, all must hold).
+                     COND is FIELD OP VALUE with OP one of = != > >= < <=
+                     or ~ (regex). Comparisons with < and > are numeric,
+                     or between durations if VALUE is one ('dur>1.5s');
+                     = and != compare the value as text. Dotted names reach
+                     into nested JSON objects: http.status. Alone, --where
+                     picks the lines to show; with other filters it
+                     narrows their matches. Head and tail are unaffected.
+  --fields A,B,...   Print records with only these fields, in order.
+                     logfmt stays logfmt, JSON stays JSON.
+  --json, --logfmt   Declare the input format; the footer counts lines
+                     not in it ("non-json N", "non-logfmt N")
+  Each line is read as a JSON object if it is one, else as logfmt
+  (key=value key="quoted value" ...) if it starts with a key=value pair
+  and mostly has pairs. Other lines are printed unchanged and never
+  match --where.
+
+SUMMARIES:
+  --summary gotest   Read go test output, plain, -v or -json, and show
+                     each failed test and build failure under a heading
+                     with its capture line range and file:line locations:
+                       ## FAIL TestParse (example.com/app, 0.01s) | lines 82-83 | at parse_test.go:42
+                     Long items are cut at 30 lines, with the glance show
+                     command for the rest. The footer counts packages and
+                     tests: "packages: 3 ok, 1 failed | tests: 40 passed,
+                     1 failed". -json events are shown as their text.
+  --summary diagnostics
+                     Group file:line compiler and linter messages by
+                     file, one row per distinct diagnostic with repeats
+                     counted, numbered by the capture line where it first
+                     appeared:
+                       ## main.go (2 errors) | lines 2-3
+                       2: 3:2   error  "os" imported and not used (x2)
+                     Reads go build/vet, gcc/clang, tsc, rustc and eslint
+                     (stylish and unix) output; messages without a
+                     severity count as errors.
+  --summary goroutines
+                     Group a Go goroutine dump (a panic with
+                     GOTRACEBACK=all, or SIGQUIT) by state and stack,
+                     ignoring argument values and goroutine IDs. The
+                     goroutine that panicked comes first, then each
+                     distinct stack once, most goroutines first:
+                       ## 1200 goroutines [chan receive, 3-15 minutes] in main.worker | lines 40-44
+  --summary can't be combined with filters or --budget.
+
+With filters, the footer counts each filter's matches over the whole
+input, including lines hidden by the head/tail windows or the budget:
+  ... | errors: 41 (first 101, last 2990) | timeout: 0 ---
+
+JSON OUTPUT:
+  --format json writes one object: {"version": 1, "lines": [...],
+  "footer": {...}}. --format jsonl writes a {"type": "header",
+  "version": 1} record, then one {"type": "line"} record per line and a
+  {"type": "footer"} record. Each line has n, text and reasons (head,
+  tail, filter, context, range, around, all, summary, trace, time), plus
+  filters naming the filters that matched and end/count for collapsed
+  runs. The footer has command, id, total, showing, sections ([[from,
+  to], ...]) and, where they apply, windows, filters ([{name, count,
+  first, last}]), records, traces ([{line, end, count}]), time ({since,
+  until}), collapsed, hidden, suppressed, reveal, exit, signal,
+  elapsed_ms and summary ({name, counts, items: [{kind, title, line,
+  end, locations, counts}]}), plus changes ({previous, removed, added,
+  hunks: [{a, a_end, b, b_end}]}) for rerun. The version only changes
+  when a field is removed or changes meaning; new fields may appear at
+  any time.
 
 SUBCOMMANDS:
   glance help [cmd]                    This help (or help for cmd)
   glance version                       Print version
+  glance run -- <cmd> [args]           Run cmd, summarize, keep exit code
+  glance rerun <id>                    Run a captured cmd again, show changes
+  glance watch --until RE -- <cmd>     Rerun cmd until RE matches, show changes
   glance show <id>                     Full stored output
+  glance show <id> --info              Created, size, label, command, exit
   glance show <id> -l 50-80            Line range
   glance show <id> -f 'regex'          Filter stored output
   glance show <id> -p errors           Filter with preset
+  glance show <id> -p errors --traces  ... with whole stack traces
+  glance show <id> -f 'timeout' --record-start '^\d{4}-'
+                                       ... with whole multi-line records
   glance show <id> -a 247 5            Context around line
+  glance show <id> --since 14:02 --until 14:05
+                                       Lines timestamped in a range
+  glance show <id> --last 5m           Last 5 minutes of the log
+  glance show <id> --summary gotest    Summarize stored output
+  glance show <id> --summary diagnostics
+                                       Compiler errors grouped by file
+  glance show <id> --summary goroutines
+                                       Distinct goroutine stacks, counted
+  glance clusters <id>                 Message templates with counts
+  glance diff <id1> <id2>              Lines added/removed between captures
   glance list                          List stored captures
   glance clean                         Purge captures
   glance presets list                  Show all presets
-  glance presets add <n> <re> [desc]   Add user preset
+  glance presets add <n> <re> [desc]   Add user preset (-x to exclude)
   glance presets remove <name>         Remove user preset
+  glance baseline add <name> <id>      Learn known-good lines (--baseline)
+  glance normalize test <line>         Show a line as lines are compared
 
 BUILT-IN PRESETS:
 `)
@@ -170,6 +542,9 @@ EXAMPLES:
   # Quick look at build output
   make 2>&1 | glance
 
+  # Run tests, keep the exit code and timing, list what failed
+  glance run --summary gotest -- go test ./...
+
   # Find errors in a long log
   kubectl logs pod/api | glance -p errors
 
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// captureMeta is what glance records next to a capture: when it was made
+// and how big it is, so list doesn't have to read it, and where it came
+// from. Captures from before it was recorded have no file, and captures of
+// glance run from before it was extended only the command fields.
+type captureMeta struct {
+	Created time.Time `json:"created,omitzero"`
+	Lines   int       `json:"lines"`
+	Bytes   int64     `json:"bytes"`
+	Dir     string    `json:"dir"`
+	// Filters are the filter flags the capture was summarized with.
+	Filters []string `json:"filters,omitempty"`
+	Label   string   `json:"label,omitempty"`
+
+	// The command and glance flags of glance run, and how it exited.
+	Command []string `json:"command,omitempty"`
+	Flags   []string `json:"flags,omitempty"`
+	Exit    *int     `json:"exit,omitempty"`
+	Signal  string   `json:"signal,omitempty"`
+	// Previous is the capture this one is a rerun of.
+	Previous string `json:"previous,omitempty"`
+}
+
+// counted reports whether m has the creation time and sizes, which older
+// glance run metadata lacks.
+func (m captureMeta) counted() bool {
+	return !m.Created.IsZero()
+}
+
+func metaPath(id string) string {
+	return filepath.Join(cacheDir(), id+".meta.json")
+}
+
+func writeCaptureMeta(id string, m captureMeta) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath(id), append(data, '\n'), 0o644)
+}
+
+// readCaptureMeta loads a capture's metadata; ok is false when it has none,
+// as for captures stored by older versions.
+func readCaptureMeta(id string) (m captureMeta, ok bool, err error) {
+	data, err := os.ReadFile(metaPath(id))
+	if os.IsNotExist(err) {
+		return m, false, nil
+	}
+	if err != nil {
+		return m, false, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, false, err
+	}
+	return m, true, nil
+}
+
+// captureInfo describes a stored capture from its metadata, falling back
+// to counting the file's lines and its modification time.
+func captureInfo(id string, now time.Time) (jsonCapture, error) {
+	c := jsonCapture{ID: id}
+	m, ok, err := readCaptureMeta(id)
+	if err != nil {
+		// Unreadable metadata only costs us the counting.
+		ok = false
+	}
+	if ok && m.counted() {
+		c.Lines, c.Bytes, c.created = m.Lines, m.Bytes, m.Created
+		c.recorded = true
+	} else {
+		info, err := os.Stat(capturePath(id))
+		if err != nil {
+			return c, err
+		}
+		c.Lines = countLines(capturePath(id))
+		c.Bytes, c.created = info.Size(), info.ModTime()
+	}
+	c.Modified = c.created.UTC().Format(time.RFC3339)
+	c.AgeSeconds = int64(now.Sub(c.created).Seconds())
+	if ok {
+		c.Dir, c.Filters, c.Label = m.Dir, m.Filters, m.Label
+		c.Command, c.Exit, c.Signal, c.Previous = m.Command, m.Exit, m.Signal, m.Previous
+	}
+	return c, nil
+}
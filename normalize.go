@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// normRule replaces one kind of token that differs between runs of the
+// same command. The regex only runs on lines with a character from hint.
+type normRule struct {
+	name string
+	re   *regexp.Regexp
+	repl string
+	hint string
+}
+
+// normalizer is an ordered list of rules; each sees the output of the one
+// before.
+type normalizer []normRule
+
+func (n normalizer) apply(s string) string {
+	for _, r := range n {
+		if r.hint == "" || strings.ContainsAny(s, r.hint) {
+			s = r.re.ReplaceAllString(s, r.repl)
+		}
+	}
+	return s
+}
+
+// builtinRules mask timestamps before their parts could be taken for
+// durations or ports.
+var builtinRules = normalizer{
+	{"uuid", regexp.MustCompile(`\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`), "<uuid>", "-"},
+	{"time", regexp.MustCompile(`\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d(?:[.,]\d+)?(?:Z|[+-]\d\d:?\d\d)?`), "<time>", ":"},
+	{"syslog-time", regexp.MustCompile(`\b[A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d\b`), "<time>", ":"},
+	{"time-of-day", regexp.MustCompile(`\b\d\d:\d\d:\d\d(?:[.,]\d+)?\b`), "<time>", ":"},
+	{"duration", regexp.MustCompile(`\b(?:\d+(?:\.\d+)?(?:ns|us|µs|ms|h|m|s))+\b`), "<dur>", "hmsµ"},
+	{"pid", regexp.MustCompile(`(?i)\b(pid[ =:]?)\d+`), "${1}<pid>", "pP"},
+	{"pid-brackets", regexp.MustCompile(`(\w)\[\d+\]`), "${1}[<pid>]", "["},
+	{"port", regexp.MustCompile(`((?:\blocalhost|\b\d{1,3}(?:\.\d{1,3}){3}|\]):)\d{1,5}\b`), "${1}<port>", ":"},
+	{"port-word", regexp.MustCompile(`(?i)\b(port[ =:]?)\d+`), "${1}<port>", "oO"},
+	{"hex", regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`), "<hex>", "x"},
+	{"tmp", regexp.MustCompile(`(?:/private)?/var/folders/[^/\s]+/[^/\s]+/T/[^/\s]+|/(?:var/)?tmp/[^/\s]+`), "<tmp>", "/"},
+}
+
+func normalizePath() string {
+	return filepath.Join(configDir(), "normalize.csv")
+}
+
+// userRules are loaded once; a rule that no longer compiles is skipped with
+// a warning rather than failing every command that compares lines.
+var userRules = sync.OnceValue(func() normalizer {
+	rules, err := readUserRules()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glance: can't read normalize rules: %s\n", err)
+	}
+	var n normalizer
+	for _, r := range rules {
+		re, err := regexp.Compile(r.regex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "glance: skipping normalize rule %s: %s\n", r.name, err)
+			continue
+		}
+		n = append(n, normRule{name: r.name, re: re, repl: r.repl})
+	}
+	return n
+})
+
+// normalize masks timestamps, UUIDs, durations, PIDs, ports, hex addresses
+// and temp directories, so the same line from two runs compares equal.
+// User rules run first, so they can match tokens the built-in rules would
+// break up.
+func normalize(s string) string {
+	return builtinRules.apply(userRules().apply(s))
+}
+
+// userRule is a rule as stored in normalize.csv.
+type userRule struct {
+	name, regex, repl string
+}
+
+func readUserRules() ([]userRule, error) {
+	f, err := os.Open(normalizePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var result []userRule
+	for _, rec := range records {
+		if len(rec) < 2 {
+			continue
+		}
+		u := userRule{name: rec[0], regex: rec[1], repl: "<" + rec[0] + ">"}
+		if len(rec) >= 3 {
+			u.repl = rec[2]
+		}
+		result = append(result, u)
+	}
+	return result, nil
+}
+
+func writeUserRules(rules []userRule) error {
+	f, err := os.Create(normalizePath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	for _, r := range rules {
+		if err := w.Write([]string{r.name, r.regex, r.repl}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func builtinRule(name string) bool {
+	for _, r := range builtinRules {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func doNormalize(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: glance normalize <list|add|remove|test>\n")
+		os.Exit(1)
+	}
+
+	sub := args[0]
+	args = args[1:]
+
+	switch sub {
+	case "list":
+		fmt.Println("Built-in rules:")
+		for _, r := range builtinRules {
+			fmt.Printf("  %-14s %-16s %s\n", r.name, r.repl, r.re)
+		}
+		rules, _ := readUserRules()
+		if len(rules) > 0 {
+			fmt.Println()
+			fmt.Println("User rules (applied first):")
+			for _, r := range rules {
+				fmt.Printf("  %-14s %-16s %s\n", r.name, r.repl, r.regex)
+			}
+		}
+
+	case "add":
+		if len(args) < 2 || len(args) > 3 {
+			fmt.Fprintf(os.Stderr, "Usage: glance normalize add <name> <regex> [replacement]\n")
+			os.Exit(1)
+		}
+		rule := userRule{name: args[0], regex: args[1], repl: "<" + args[0] + ">"}
+		if len(args) == 3 {
+			rule.repl = args[2]
+		}
+		if !isValidPresetName(rule.name) {
+			fmt.Fprintf(os.Stderr, "glance: invalid rule name: %s (must start with alphanumeric, use only alphanumeric/hyphens/underscores)\n", rule.name)
+			os.Exit(1)
+		}
+		if builtinRule(rule.name) {
+			fmt.Fprintf(os.Stderr, "glance: cannot override built-in rule: %s\n", rule.name)
+			os.Exit(1)
+		}
+		if _, err := compileRegex(rule.regex); err != nil {
+			fmt.Fprintf(os.Stderr, "glance: %s\n", err)
+			os.Exit(1)
+		}
+		if err := ensureConfigDir(); err != nil {
+			fatal(err.Error())
+		}
+		existing, err := readUserRules()
+		if err != nil {
+			fatal(err.Error())
+		}
+		var kept []userRule
+		for _, r := range existing {
+			if r.name != rule.name {
+				kept = append(kept, r)
+			}
+		}
+		if err := writeUserRules(append(kept, rule)); err != nil {
+			fatal(err.Error())
+		}
+		fmt.Printf("Added rule: %s\n", rule.name)
+
+	case "remove":
+		if len(args) < 1 {
+			fmt.Fprintf(os.Stderr, "Usage: glance normalize remove <name>\n")
+			os.Exit(1)
+		}
+		name := args[0]
+		if builtinRule(name) {
+			fmt.Fprintf(os.Stderr, "glance: cannot remove built-in rule: %s\n", name)
+			os.Exit(1)
+		}
+		existing, _ := readUserRules()
+		var kept []userRule
+		for _, r := range existing {
+			if r.name != name {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == len(existing) {
+			fmt.Fprintf(os.Stderr, "glance: rule not found: %s\n", name)
+			os.Exit(1)
+		}
+		if err := writeUserRules(kept); err != nil {
+			fatal(err.Error())
+		}
+		fmt.Printf("Removed rule: %s\n", name)
+
+	case "test":
+		// Lines come from the arguments, or stdin without any.
+		if len(args) > 0 {
+			for _, a := range args {
+				fmt.Println(normalize(a))
+			}
+			return
+		}
+		bw := bufio.NewWriter(os.Stdout)
+		defer bw.Flush()
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, scanBufferSize), scanBufferSize)
+		for scanner.Scan() {
+			fmt.Fprintln(bw, normalize(scanner.Text()))
+		}
+		if err := scanner.Err(); err != nil {
+			fatal(err.Error())
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "glance normalize: unknown subcommand: %s\n", sub)
+		os.Exit(1)
+	}
+}
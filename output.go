@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+)
+
+// jsonSchemaVersion is bumped whenever a JSON field is removed or changes
+// meaning. Adding fields does not bump it, so readers should ignore fields
+// they don't know.
+const jsonSchemaVersion = 1
+
+type outputFormat int
+
+const (
+	formatText outputFormat = iota
+	// formatJSON writes one document holding every line and the footer.
+	formatJSON
+	// formatJSONL writes a header record, one record per line and a footer
+	// record, each on its own line, so output can be read as it streams.
+	formatJSONL
+)
+
+func parseFormatName(s string) (outputFormat, error) {
+	switch s {
+	case "text":
+		return formatText, nil
+	case "json":
+		return formatJSON, nil
+	case "jsonl":
+		return formatJSONL, nil
+	}
+	return formatText, fmt.Errorf("--format must be text, json or jsonl")
+}
+
+// showReason records why a line was shown, as a set of bits.
+type showReason uint16
+
+const (
+	reasonHead showReason = 1 << iota
+	reasonTail
+	reasonFilter
+	reasonContext
+	reasonRange
+	reasonAround
+	// reasonAll marks lines shown because nothing narrowed the selection.
+	reasonAll
+	// reasonSummary marks lines belonging to a --summary item.
+	reasonSummary
+	// reasonTrace marks lines of a stack trace that a filter matched
+	// elsewhere in (--traces).
+	reasonTrace
+	// reasonTime marks lines within show's --since/--until/--last range.
+	reasonTime
+)
+
+var reasonNames = []string{"head", "tail", "filter", "context", "range", "around", "all", "summary", "trace", "time"}
+
+func (r showReason) names() []string {
+	names := []string{}
+	for i, name := range reasonNames {
+		if r&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// jsonLine is one shown line. A collapsed run has End and Count set and
+// the text of its first line.
+type jsonLine struct {
+	Type    string   `json:"type,omitempty"`
+	N       int      `json:"n"`
+	End     int      `json:"end,omitempty"`
+	Count   int      `json:"count,omitempty"`
+	Text    string   `json:"text"`
+	Reasons []string `json:"reasons"`
+	// Filters names the filters that matched, for lines shown by one.
+	Filters []string `json:"filters,omitempty"`
+}
+
+// jsonWindows are the head and tail line ranges in pipe mode; nil means
+// the window is empty.
+type jsonWindows struct {
+	Head *[2]int `json:"head"`
+	Tail *[2]int `json:"tail"`
+}
+
+// jsonFooter is the footer of pipe, run and show. Fields that don't apply
+// to the command are omitted.
+type jsonFooter struct {
+	Type     string       `json:"type,omitempty"`
+	Command  string       `json:"command"`
+	ID       string       `json:"id,omitempty"`
+	Total    int          `json:"total"`
+	Records  int          `json:"records,omitempty"`
+	Showing  int          `json:"showing"`
+	Sections [][2]int     `json:"sections"`
+	Windows  *jsonWindows `json:"windows,omitempty"`
+	// Filters has match statistics for each include filter, over every
+	// line read rather than only the lines shown.
+	Filters   []jsonFilterStat `json:"filters,omitempty"`
+	Traces    []traceStat      `json:"traces,omitempty"`
+	Time      *jsonTimeRange   `json:"time,omitempty"`
+	NonJSON   int              `json:"non_json,omitempty"`
+	NonLogfmt int              `json:"non_logfmt,omitempty"`
+	Summary   *summaryReport   `json:"summary,omitempty"`
+	Changes   *jsonChanges     `json:"changes,omitempty"`
+	Collapsed int              `json:"collapsed,omitempty"`
+	Hidden    int              `json:"hidden,omitempty"`
+	Reveal    string           `json:"reveal,omitempty"`
+	Exit      *int             `json:"exit,omitempty"`
+	Signal    string           `json:"signal,omitempty"`
+	ElapsedMS *int64           `json:"elapsed_ms,omitempty"`
+
+	// Suppressed counts filter matches dropped by --baseline.
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// jsonFilterStat is one filter's statistics. First and Last are 0 when
+// it matched nothing.
+type jsonFilterStat struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	First int    `json:"first"`
+	Last  int    `json:"last"`
+}
+
+type jsonHeader struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+}
+
+type jsonDoc struct {
+	Version int        `json:"version"`
+	Lines   []jsonLine `json:"lines"`
+	Footer  jsonFooter `json:"footer"`
+}
+
+// writeJSON encodes v as one line, leaving <, > and & alone since the
+// output is read by programs, not embedded in HTML.
+func writeJSON(w *bufio.Writer, v any) {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// record writes or buffers one line in a JSON format.
+func (lw *lineWriter) record(l jsonLine) {
+	if lw.format == formatJSON {
+		lw.records = append(lw.records, l)
+		return
+	}
+	lw.header()
+	l.Type = "line"
+	writeJSON(lw.w, l)
+}
+
+// header writes the JSONL header record once, before anything else.
+func (lw *lineWriter) header() {
+	if lw.format != formatJSONL || lw.started {
+		return
+	}
+	lw.started = true
+	writeJSON(lw.w, jsonHeader{Type: "header", Version: jsonSchemaVersion})
+}
+
+// heading prints a line that isn't from the capture, such as a summary
+// item's title. JSON output carries that information in the footer.
+func (lw *lineWriter) heading(s string) {
+	lw.flush()
+	if lw.format == formatText {
+		fmt.Fprintf(lw.w, "## %s\n", s)
+	}
+}
+
+// finish writes the footer in a JSON format: the whole document for
+// formatJSON, or the footer record for formatJSONL.
+func (lw *lineWriter) finish(f jsonFooter) {
+	lw.flush()
+	if f.Sections == nil {
+		f.Sections = [][2]int{}
+	}
+	if lw.format == formatJSON {
+		lines := lw.records
+		if lines == nil {
+			lines = []jsonLine{}
+		}
+		writeJSON(lw.w, jsonDoc{Version: jsonSchemaVersion, Lines: lines, Footer: f})
+		return
+	}
+	lw.header()
+	f.Type = "footer"
+	writeJSON(lw.w, f)
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 func cacheDir() string {
@@ -29,6 +31,23 @@ func capturePath(id string) string {
 	return filepath.Join(cacheDir(), id+".txt")
 }
 
+// validCaptureID rejects IDs that could escape the captures directory.
+func validCaptureID(id string) bool {
+	return id != "" && !strings.Contains(id, "/") && !strings.Contains(id, "..")
+}
+
+// requireCapture returns the path of a stored capture, exiting with a hint
+// if it does not exist.
+func requireCapture(id string) string {
+	path := capturePath(id)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "glance: capture not found: %s\n", id)
+		fmt.Fprintf(os.Stderr, "Use \"glance list\" to see stored captures.\n")
+		os.Exit(1)
+	}
+	return path
+}
+
 func ensureCacheDir() error {
 	return os.MkdirAll(cacheDir(), 0o755)
 }
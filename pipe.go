@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"sort"
@@ -23,21 +24,44 @@ func genID() string {
 const defaultHeadTail = 10
 
 type pipeConfig struct {
-	n       int
-	filters []string
-	noStore bool
+	head     int
+	tail     int
+	before   int
+	after    int
+	match    matchFlags
+	budget   budget
+	collapse collapseMode
+	format   outputFormat
+	records  recordFlags
+	// summary names a summarizer that replaces the head/tail view.
+	summary string
+	// traceDepth is the number of lines of a matched stack trace to show,
+	// or 0 to treat trace lines like any other (--traces).
+	traceDepth int
+	// recordStart, if set, groups lines into multi-line records that each
+	// start with a line matching it (--record-start).
+	recordStart *regexp.Regexp
+	noStore     bool
+	// label is recorded with the capture and shown by glance list.
+	label string
 }
 
 func parsePipeArgs(args []string) (pipeConfig, error) {
-	cfg := pipeConfig{n: defaultHeadTail}
+	cfg := pipeConfig{head: defaultHeadTail, tail: defaultHeadTail}
 
 	i := 0
 	for i < len(args) {
-		if parseFilter(args, &i, &cfg.filters) {
+		if parseFilter(args, &i, &cfg.match) {
+			continue
+		}
+		if parseCollapse(args, &i, &cfg.collapse) {
+			continue
+		}
+		if parseRecordFlags(args, &i, &cfg.records) {
 			continue
 		}
 		switch args[i] {
-		case "-n", "--lines", "--head":
+		case "-n", "--lines":
 			if i+1 >= len(args) {
 				return cfg, fmt.Errorf("-n must be a positive integer")
 			}
@@ -45,15 +69,95 @@ func parsePipeArgs(args []string) (pipeConfig, error) {
 			if v <= 0 {
 				return cfg, fmt.Errorf("-n must be a positive integer")
 			}
-			cfg.n = v
+			cfg.head, cfg.tail = v, v
+			i += 2
+		case "--head", "--tail":
+			flag := args[i]
+			if i+1 >= len(args) {
+				return cfg, fmt.Errorf("%s must be a non-negative integer", flag)
+			}
+			v, ok := parseCount(args[i+1])
+			if !ok {
+				return cfg, fmt.Errorf("%s must be a non-negative integer", flag)
+			}
+			if flag == "--head" {
+				cfg.head = v
+			} else {
+				cfg.tail = v
+			}
 			i += 2
+		case "-A", "-B", "-C", "--after-context", "--before-context", "--context":
+			flag := args[i]
+			if i+1 >= len(args) {
+				return cfg, fmt.Errorf("%s must be a positive integer", flag)
+			}
+			v := parsePositiveInt(args[i+1])
+			if v <= 0 {
+				return cfg, fmt.Errorf("%s must be a positive integer", flag)
+			}
+			switch flag {
+			case "-A", "--after-context":
+				cfg.after = v
+			case "-B", "--before-context":
+				cfg.before = v
+			default:
+				cfg.before, cfg.after = v, v
+			}
+			i += 2
+		case "--budget":
+			if i+1 >= len(args) {
+				return cfg, fmt.Errorf("--budget must be N (lines) or Nt (tokens)")
+			}
+			b, err := parseBudget(args[i+1])
+			if err != nil {
+				return cfg, err
+			}
+			cfg.budget = b
+			i += 2
+		case "--format":
+			f, err := parseFormatName(consumeFlag(args, &i, "--format"))
+			if err != nil {
+				return cfg, err
+			}
+			cfg.format = f
+		case "--summary":
+			cfg.summary = consumeFlag(args, &i, "--summary")
+			if err := checkSummaryName(cfg.summary); err != nil {
+				return cfg, err
+			}
+		case "--traces":
+			cfg.traceDepth = defaultTraceDepth
+			i++
+		case "--trace-depth":
+			v := parsePositiveInt(consumeFlag(args, &i, "--trace-depth"))
+			if v <= 0 {
+				return cfg, fmt.Errorf("--trace-depth must be a positive integer")
+			}
+			cfg.traceDepth = v
+		case "--record-start":
+			re, err := compileRegex(consumeFlag(args, &i, "--record-start"))
+			if err != nil {
+				return cfg, err
+			}
+			cfg.recordStart = re
 		case "--no-store":
 			cfg.noStore = true
 			i++
+		case "--label":
+			cfg.label = consumeFlag(args, &i, "--label")
 		default:
 			return cfg, fmt.Errorf("unknown flag: %s", args[i])
 		}
 	}
+	if cfg.summary != "" && (cfg.match.selects() || cfg.budget.limit > 0) {
+		return cfg, fmt.Errorf("--summary can't be combined with filters or --budget")
+	}
+	if cfg.recordStart != nil && (cfg.summary != "" || cfg.traceDepth > 0) {
+		return cfg, fmt.Errorf("--record-start can't be combined with --summary or --traces")
+	}
+	if cfg.label != "" && cfg.noStore {
+		return cfg, fmt.Errorf("--label can't be combined with --no-store")
+	}
 	return cfg, nil
 }
 
@@ -70,10 +174,89 @@ func doPipe(args []string) {
 }
 
 func runPipe(cfg pipeConfig) {
+	bw := bufio.NewWriter(os.Stdout)
+	out := newLineWriter(bw, cfg.collapse, cfg.format)
+	res := summarize(cfg, os.Stdin, out)
+	if res.id != "" {
+		recordCapture(res.id, res.meta)
+	}
+	writePipeFooter(out, res, nil)
+	bw.Flush()
+}
+
+// pipeResult is what the footer needs once the input has been consumed.
+type pipeResult struct {
+	id      string
+	total   int
+	printed []int
+	// head and tail are the configured window sizes.
+	head, tail int
+	// records counts multi-line records with --record-start, whose head
+	// and tail windows end and start at recordsHeadEnd and
+	// recordsTailStart.
+	records                          int
+	recordsHeadEnd, recordsTailStart int
+	// hidden counts middle matches dropped to stay within the budget.
+	hidden int
+	reveal string
+	// collapsed counts repeated lines folded into runs.
+	collapsed int
+	stats     *filterStats
+	// unparsed counts lines that weren't in the format declared with
+	// --json or --logfmt.
+	unparsed int
+	declared recordKind
+	summary  *summaryReport
+	traces   *traceGrouper
+	// meta describes the stored capture, to be recorded once the caller
+	// has added what it knows.
+	meta captureMeta
+}
+
+// windows describes the head and tail windows as footer segments.
+func (res pipeResult) windows() []string {
+	headEnd, tailStart := res.bounds()
+	return []string{window("head", 1, headEnd), window("tail", tailStart, res.total)}
+}
+
+// bounds returns the last line of the head window and the first of the
+// tail window.
+func (res pipeResult) bounds() (headEnd, tailStart int) {
+	if res.records > 0 {
+		return res.recordsHeadEnd, res.recordsTailStart
+	}
+	headEnd = min(res.head, res.total)
+	return headEnd, max(headEnd+1, res.total-res.tail+1)
+}
+
+func window(name string, from, to int) string {
+	switch {
+	case from > to:
+		return name + ": none"
+	case from == to:
+		return fmt.Sprintf("%s: %d", name, from)
+	}
+	return fmt.Sprintf("%s: %d-%d", name, from, to)
+}
+
+// middleLine is a middle line held back for budget selection. owner is the
+// match that pulled it in.
+type middleLine struct {
+	num   int
+	text  string
+	owner int
+	why   showReason
+}
+
+// summarize streams in through the head window, filters and tail ring,
+// writing numbered lines to out and storing the capture unless disabled.
+func summarize(cfg pipeConfig, in io.Reader, out *lineWriter) pipeResult {
 	// Open capture file if storing
 	var captureID string
 	var captureW *bufio.Writer
 	var captureF *os.File
+	var captureBytes int64
+	created := time.Now()
 	if !cfg.noStore {
 		if err := ensureCacheDir(); err != nil {
 			fatal(err.Error())
@@ -89,19 +272,135 @@ func runPipe(cfg pipeConfig) {
 	}
 
 	// Compile filters
-	filters, err := compileFilters(cfg.filters)
+	filters, err := compileMatch(cfg.match)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "glance: %s\n", err)
 		os.Exit(1)
 	}
+	out.filters = filters
+	out.fields = cfg.records.fields
+	stats := newFilterStats(filters)
+	unparsed := 0
+	var sum summarizer
+	if cfg.summary != "" {
+		sum = summarizers[cfg.summary]()
+	}
+	var traces *traceGrouper
+	if cfg.traceDepth > 0 {
+		traces = newTraceGrouper(cfg.traceDepth)
+	}
+	var entries *entryGrouper
+	if cfg.recordStart != nil {
+		entries = newEntryGrouper(cfg.recordStart)
+	}
+	// With --record-start everything below works on records, numbered from
+	// 1, rather than lines. firstLine maps the records that may still be
+	// printed to their first line.
+	firstLine := make(map[int]int)
+	records := 0
+	recordsHeadEnd := 0
+	// Lines shown only for being part of a matched trace.
+	traceOnly := make(map[int]bool)
+	matchReason := func(num int) showReason {
+		if traceOnly[num] {
+			delete(traceOnly, num)
+			return reasonTrace
+		}
+		return reasonFilter
+	}
 
-	n := cfg.n
-	ring := newRingBuffer(n)
-	bw := bufio.NewWriter(os.Stdout)
+	n := cfg.head
+	ring := newRingBuffer(cfg.tail)
+	// Lines that left the tail ring without being printed, kept in case a
+	// later match wants them as before-context.
+	lookbehind := newRingBuffer(cfg.before)
+	// Last line number still covered by a match's after-context, and the
+	// match it belongs to.
+	printUntil := 0
+	lastMatch := 0
 	var printed []int
 	lineNo := 0
 
-	scanner := bufio.NewScanner(os.Stdin)
+	spent := 0
+	emit := func(num int, text string, why showReason) {
+		spent += cfg.budget.cost(num, text)
+		if entries == nil {
+			out.write(num, text, why)
+			printed = append(printed, num)
+			return
+		}
+		first := firstLine[num]
+		delete(firstLine, num)
+		for i, line := range strings.Split(text, "\n") {
+			out.write(first+i, line, why)
+			printed = append(printed, first+i)
+		}
+	}
+	// With a budget, middle lines wait until the end so that matches can be
+	// sampled once we know how many there are.
+	sampler := newBudgetSampler(cfg.budget)
+	emitMiddle := func(num int, text string, owner int, why showReason) {
+		if cfg.budget.limit == 0 {
+			emit(num, text, why)
+			return
+		}
+		sampler.add(middleLine{num: num, text: text, owner: owner, why: why})
+	}
+
+	process := func(l tracedLine) {
+		matched := (l.names != nil || l.trace == traceShown) && l.trace != traceHidden
+		if l.trace == traceShown && l.names == nil {
+			traceOnly[l.num] = true
+		}
+		if l.num <= n {
+			// Head: print eagerly
+			why := reasonHead
+			if matched {
+				why |= matchReason(l.num)
+			}
+			emit(l.num, l.text, why)
+			if matched {
+				printUntil = l.num + cfg.after
+				lastMatch = l.num
+			}
+			return
+		}
+
+		// Past head: use ring buffer
+		evicted, ok := ring.push(l.num, l.text, matched)
+		if !ok {
+			return
+		}
+		switch {
+		case evicted.matched:
+			// Evicted middle match: print it with its context
+			for _, e := range lookbehind.entries() {
+				emitMiddle(e.num, e.text, evicted.num, reasonContext)
+			}
+			lookbehind.reset()
+			emitMiddle(evicted.num, evicted.text, evicted.num, matchReason(evicted.num))
+			printUntil = evicted.num + cfg.after
+			lastMatch = evicted.num
+		case evicted.num <= printUntil:
+			emitMiddle(evicted.num, evicted.text, lastMatch, reasonContext)
+		default:
+			if dropped, ok := lookbehind.push(evicted.num, evicted.text, false); ok {
+				delete(firstLine, dropped.num)
+			}
+		}
+	}
+	addEntry := func(e entry) {
+		records++
+		firstLine[records] = e.first
+		if records == cfg.head {
+			recordsHeadEnd = e.last
+		}
+		names := filters.matching(e.text)
+		stats.add(e.first, names)
+		process(tracedLine{num: records, text: e.text, names: names})
+	}
+
+	scanner := bufio.NewScanner(in)
 	scanner.Buffer(make([]byte, scanBufferSize), scanBufferSize)
 	for scanner.Scan() {
 		lineNo++
@@ -111,58 +410,220 @@ func runPipe(cfg pipeConfig) {
 		if captureW != nil {
 			captureW.WriteString(text)
 			captureW.WriteByte('\n')
+			captureBytes += int64(len(text)) + 1
 		}
 
-		if lineNo <= n {
-			// Head: print eagerly
-			fmt.Fprintf(bw, "%d: %s\n", lineNo, text)
-			printed = append(printed, lineNo)
+		if cfg.records.declared != kindText && !isRecord(text, cfg.records.declared) {
+			unparsed++
+		}
+		if sum != nil {
+			sum.add(lineNo, text)
 			continue
 		}
-
-		// Past head: use ring buffer
-		matched := matchesAny(filters, text)
-		evicted, ok := ring.push(lineNo, text, matched)
-		if ok && evicted.matched {
-			// Evicted middle match: print it
-			fmt.Fprintf(bw, "%d: %s\n", evicted.num, evicted.text)
-			printed = append(printed, evicted.num)
+		if entries != nil {
+			if e, ok := entries.push(lineNo, text); ok {
+				addEntry(e)
+			}
+			continue
+		}
+		names := filters.matching(text)
+		stats.add(lineNo, names)
+		if traces == nil {
+			process(tracedLine{num: lineNo, text: text, names: names})
+			continue
+		}
+		for _, l := range traces.push(lineNo, text, names) {
+			process(l)
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		fatal(err.Error())
 	}
+	if traces != nil {
+		for _, l := range traces.flush() {
+			process(l)
+		}
+	}
+	if entries != nil {
+		if e, ok := entries.flush(); ok {
+			addEntry(e)
+		}
+	}
 
 	// Flush capture
 	if captureW != nil {
 		captureW.Flush()
 	}
 
-	total := lineNo
-
-	// Print tail from ring buffer
+	// Before-context of the first match in the tail may still be waiting in
+	// the lookbehind buffer.
+	var tail []ringEntry
 	for _, e := range ring.entries() {
-		fmt.Fprintf(bw, "%d: %s\n", e.num, e.text)
-		printed = append(printed, e.num)
+		if !e.matched {
+			continue
+		}
+		for _, b := range lookbehind.entries() {
+			if b.num >= e.num-cfg.before {
+				tail = append(tail, b)
+			}
+		}
+		break
 	}
+	tail = append(tail, ring.entries()...)
 
-	// Footer
-	sort.Ints(printed)
-	sections := sectionRanges(printed)
+	res := pipeResult{id: captureID, total: lineNo, head: cfg.head, tail: cfg.tail, records: records}
+	units := lineNo
+	if entries != nil {
+		units = records
+		res.recordsHeadEnd = lineNo
+		if records > cfg.head {
+			res.recordsHeadEnd = recordsHeadEnd
+		}
+		res.recordsTailStart = lineNo + 1
+		if r := ring.entries(); len(r) > 0 {
+			res.recordsTailStart = firstLine[r[0].num]
+		}
+	}
 	if captureID != "" {
-		if total == 0 {
-			fmt.Fprintf(bw, "--- glance id=%s | 0 lines | showing 0 ---\n", captureID)
-		} else {
-			fmt.Fprintf(bw, "--- glance id=%s | %s | showing %d | sections: %s ---\n", captureID, pluralLines(total), len(printed), sections)
+		dir, _ := os.Getwd()
+		res.meta = captureMeta{Created: created, Lines: lineNo, Bytes: captureBytes, Dir: dir, Filters: cfg.match.args, Label: cfg.label}
+	}
+	res.stats = stats
+	res.unparsed = unparsed
+	res.declared = cfg.records.declared
+	if sum != nil {
+		res.summary = sum.report()
+		res.printed = writeSummary(out, res.summary, captureID)
+		res.collapsed = out.folded
+		return res
+	}
+	if sampler.seen > 0 {
+		for _, e := range tail {
+			spent += cfg.budget.cost(e.num, e.text)
+		}
+		kept, hidden := sampler.finish(cfg.budget.limit - spent)
+		for _, m := range kept {
+			emit(m.num, m.text, m.why)
 		}
-	} else {
-		if total == 0 {
-			fmt.Fprintf(bw, "--- glance | 0 lines | showing 0 ---\n")
-		} else {
-			fmt.Fprintf(bw, "--- glance | %s | showing %d | sections: %s ---\n", pluralLines(total), len(printed), sections)
+		res.hidden = hidden
+		if hidden > 0 && captureID != "" {
+			args := cfg.match.args
+			if cfg.recordStart != nil {
+				args = append(args[:len(args):len(args)], "--record-start", cfg.recordStart.String())
+			}
+			res.reveal = "glance show " + captureID + " " + shellJoin(args)
 		}
 	}
-	bw.Flush()
+
+	// Print tail from ring buffer. Lines before the ring are before-context.
+	ringStart := units - len(ring.entries()) + 1
+	for _, e := range tail {
+		why := reasonTail
+		if e.num < ringStart {
+			why = reasonContext
+		}
+		if e.matched {
+			why |= matchReason(e.num)
+		}
+		emit(e.num, e.text, why)
+	}
+
+	out.flush()
+	sort.Ints(printed)
+	res.printed = printed
+	res.collapsed = out.folded
+	res.traces = traces
+	return res
+}
+
+// recordCapture writes a capture's metadata. Without it list and show fall
+// back to reading the capture, so failing only warns.
+func recordCapture(id string, m captureMeta) {
+	if err := writeCaptureMeta(id, m); err != nil {
+		fmt.Fprintf(os.Stderr, "glance: can't record capture metadata: %s\n", err)
+	}
+}
+
+// writePipeFooter prints the summary footer. run describes the command
+// for glance run and is nil in pipe mode.
+func writePipeFooter(out *lineWriter, res pipeResult, run *runResult) {
+	if out.format != formatText {
+		f := res.jsonFooter()
+		if run != nil {
+			run.addJSON(&f)
+		}
+		out.finish(f)
+		return
+	}
+	head := "glance"
+	if res.id != "" {
+		head = "glance id=" + res.id
+	}
+	parts := []string{head, pluralLines(res.total)}
+	if res.records > 0 {
+		parts = append(parts, plural(res.records, "record"))
+	}
+	parts = append(parts, fmt.Sprintf("showing %d", len(res.printed)))
+	if res.total > 0 {
+		parts = append(parts, "sections: "+sectionRanges(res.printed))
+	}
+	if res.total > 0 && res.head != res.tail && res.summary == nil {
+		parts = append(parts, res.windows()...)
+	}
+	parts = append(parts, res.stats.footer()...)
+	parts = append(parts, res.traces.footer()...)
+	if res.summary != nil {
+		parts = append(parts, res.summary.segments...)
+	}
+	if res.unparsed > 0 {
+		parts = append(parts, unparsedSegment(res.declared, res.unparsed))
+	}
+	if res.collapsed > 0 {
+		parts = append(parts, fmt.Sprintf("collapsed %d", res.collapsed))
+	}
+	if res.hidden > 0 {
+		hidden := plural(res.hidden, "more match") + " hidden"
+		if res.reveal != "" {
+			hidden += ": " + res.reveal
+		}
+		parts = append(parts, hidden)
+	}
+	if run != nil {
+		parts = append(parts, run.footer()...)
+	}
+	fmt.Fprintf(out.w, "--- %s ---\n", strings.Join(parts, " | "))
+}
+
+func (res pipeResult) jsonFooter() jsonFooter {
+	f := jsonFooter{
+		Command:   "pipe",
+		ID:        res.id,
+		Total:     res.total,
+		Records:   res.records,
+		Showing:   len(res.printed),
+		Sections:  sectionSpans(res.printed),
+		Filters:   res.stats.json(),
+		Traces:    res.traces.json(),
+		Collapsed: res.collapsed,
+		Hidden:    res.hidden,
+		Reveal:    res.reveal,
+		Summary:   res.summary,
+	}
+	f.setUnparsed(res.declared, res.unparsed)
+	f.Suppressed = res.stats.suppressed()
+	if res.total > 0 && res.summary == nil {
+		headEnd, tailStart := res.bounds()
+		f.Windows = &jsonWindows{Head: span(1, headEnd), Tail: span(tailStart, res.total)}
+	}
+	return f
+}
+
+// span returns the range from-to, or nil if it is empty.
+func span(from, to int) *[2]int {
+	if from > to {
+		return nil
+	}
+	return &[2]int{from, to}
 }
 
 // ringEntry holds a buffered line for the tail window.
@@ -203,6 +664,12 @@ func (r *ringBuffer) push(num int, text string, matched bool) (ringEntry, bool)
 	return evicted, didEvict
 }
 
+// reset empties the buffer, keeping its capacity.
+func (r *ringBuffer) reset() {
+	r.pos = 0
+	r.full = false
+}
+
 // entries returns all buffered entries in insertion order.
 func (r *ringBuffer) entries() []ringEntry {
 	if !r.full {
@@ -214,25 +681,13 @@ func (r *ringBuffer) entries() []ringEntry {
 	return out
 }
 
-func compileFilters(filters []string) ([]*regexp.Regexp, error) {
-	res := make([]*regexp.Regexp, len(filters))
-	for i, f := range filters {
-		re, err := regexp.Compile(f)
-		if err != nil {
-			return nil, fmt.Errorf("invalid regex %s: %w", f, err)
-		}
-		res[i] = re
-	}
-	return res, nil
-}
-
-func matchesAny(res []*regexp.Regexp, s string) bool {
-	for _, re := range res {
-		if re.MatchString(s) {
-			return true
-		}
+// parseCount parses a non-negative integer.
+func parseCount(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, false
 	}
-	return false
+	return n, true
 }
 
 func parsePositiveInt(s string) int {
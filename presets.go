@@ -11,21 +11,23 @@ type preset struct {
 	name  string
 	regex string
 	desc  string
+	// exclude vetoes lines the regex would otherwise match.
+	exclude string
 }
 
 var builtinPresets = []preset{
-	{"errors", `(?i)error|err|fail|fatal|panic|exception|traceback`, "Error detection"},
-	{"warnings", `(?i)warn|warning|deprecated`, "Warnings"},
-	{"status", `(?i)exit code|status|returned?\s+[0-9]+|HTTP\s+[45][0-9][0-9]`, "Status/exit codes"},
+	{"errors", `(?i)error|err|fail|fatal|panic|exception|traceback`, "Error detection", `(?i)\b(0|no) (errors?|failures?|failed)\b`},
+	{"warnings", `(?i)warn|warning|deprecated`, "Warnings", `(?i)\b(0|no) warnings?\b`},
+	{"status", `(?i)exit code|status|returned?\s+[0-9]+|HTTP\s+[45][0-9][0-9]`, "Status/exit codes", ""},
 }
 
-func getBuiltinPreset(name string) (string, bool) {
+func getBuiltinPreset(name string) (preset, bool) {
 	for _, p := range builtinPresets {
 		if p.name == name {
-			return p.regex, true
+			return p, true
 		}
 	}
-	return "", false
+	return preset{}, false
 }
 
 func scanPresetFile(path string) ([]preset, error) {
@@ -38,6 +40,8 @@ func scanPresetFile(path string) ([]preset, error) {
 	}
 	defer f.Close()
 	r := csv.NewReader(f)
+	// Older files have no exclude column
+	r.FieldsPerRecord = -1
 	records, err := r.ReadAll()
 	if err != nil {
 		return nil, err
@@ -51,32 +55,35 @@ func scanPresetFile(path string) ([]preset, error) {
 		if len(rec) >= 3 {
 			p.desc = rec[2]
 		}
+		if len(rec) >= 4 {
+			p.exclude = rec[3]
+		}
 		result = append(result, p)
 	}
 	return result, nil
 }
 
-func getUserPreset(name string) (string, bool) {
+func getUserPreset(name string) (preset, bool) {
 	presets, err := scanPresetFile(configPath())
 	if err != nil {
-		return "", false
+		return preset{}, false
 	}
 	for _, p := range presets {
 		if p.name == name {
-			return p.regex, true
+			return p, true
 		}
 	}
-	return "", false
+	return preset{}, false
 }
 
-func resolvePreset(name string) (string, error) {
-	if r, ok := getBuiltinPreset(name); ok {
-		return r, nil
+func resolvePreset(name string) (preset, error) {
+	if p, ok := getBuiltinPreset(name); ok {
+		return p, nil
 	}
-	if r, ok := getUserPreset(name); ok {
-		return r, nil
+	if p, ok := getUserPreset(name); ok {
+		return p, nil
 	}
-	return "", fmt.Errorf("glance: unknown preset: %s", name)
+	return preset{}, fmt.Errorf("glance: unknown preset: %s", name)
 }
 
 func readUserPresets() ([]preset, error) {
@@ -106,7 +113,7 @@ func writePresets(path string, presets []preset) error {
 	defer f.Close()
 	w := csv.NewWriter(f)
 	for _, p := range presets {
-		if err := w.Write([]string{p.name, p.regex, p.desc}); err != nil {
+		if err := w.Write([]string{p.name, p.regex, p.desc, p.exclude}); err != nil {
 			return err
 		}
 	}
@@ -127,20 +134,32 @@ func doPresets(args []string) {
 	case "list":
 		fmt.Println("Built-in presets:")
 		for _, p := range builtinPresets {
-			fmt.Printf("  %-10s %-20s %s\n", p.name, p.desc, p.regex)
+			printPreset(p)
 		}
 		userPresets, _ := readUserPresets()
 		if len(userPresets) > 0 {
 			fmt.Println()
 			fmt.Println("User presets:")
 			for _, p := range userPresets {
-				fmt.Printf("  %-10s %-20s %s\n", p.name, p.desc, p.regex)
+				printPreset(p)
 			}
 		}
 
 	case "add":
+		// -x may appear anywhere; the rest is positional
+		exclude := ""
+		var rest []string
+		for i := 0; i < len(args); {
+			if args[i] == "-x" || args[i] == "--exclude" {
+				exclude = consumeFlag(args, &i, "-x")
+				continue
+			}
+			rest = append(rest, args[i])
+			i++
+		}
+		args = rest
 		if len(args) < 2 {
-			fmt.Fprintf(os.Stderr, "Usage: glance presets add <name> <regex> [description]\n")
+			fmt.Fprintf(os.Stderr, "Usage: glance presets add [-x exclude] <name> <regex> [description]\n")
 			os.Exit(1)
 		}
 		name := args[0]
@@ -174,7 +193,7 @@ func doPresets(args []string) {
 				kept = append(kept, p)
 			}
 		}
-		kept = append(kept, preset{name: name, regex: regex, desc: desc})
+		kept = append(kept, preset{name: name, regex: regex, desc: desc, exclude: exclude})
 
 		if err := writePresets(confPath, kept); err != nil {
 			fatal(err.Error())
@@ -227,3 +246,10 @@ func doPresets(args []string) {
 		os.Exit(1)
 	}
 }
+
+func printPreset(p preset) {
+	fmt.Printf("  %-10s %-20s %s\n", p.name, p.desc, p.regex)
+	if p.exclude != "" {
+		fmt.Printf("  %-10s %-20s exclude: %s\n", "", "", p.exclude)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// killGroupOnCancel leaves cmd to the default cancellation, which kills
+// only the process itself.
+func killGroupOnCancel(cmd *exec.Cmd) {}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A query combines regexes and preset names with AND, OR, NOT and
+// parentheses, e.g. errors AND /db/ AND NOT /timeout/i.
+//
+//	or      = and { OR and }
+//	and     = unary { AND unary }
+//	unary   = NOT unary | primary
+//	primary = "(" or ")" | /regex/[i] | preset-name
+
+type andMatcher []matcher
+
+func (m andMatcher) match(s string) bool {
+	for _, c := range m {
+		if !c.match(s) {
+			return false
+		}
+	}
+	return true
+}
+
+type orMatcher []matcher
+
+func (m orMatcher) match(s string) bool {
+	for _, c := range m {
+		if c.match(s) {
+			return true
+		}
+	}
+	return false
+}
+
+type notMatcher struct{ m matcher }
+
+func (m notMatcher) match(s string) bool { return !m.m.match(s) }
+
+// queryError points at the offending position in the query.
+type queryError struct {
+	query string
+	pos   int
+	msg   string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("invalid query: %s at position %d\n  %s\n  %s^",
+		e.msg, e.pos+1, e.query, strings.Repeat(" ", e.pos))
+}
+
+type queryTokenKind int
+
+const (
+	tokEOF queryTokenKind = iota
+	tokLParen
+	tokRParen
+	tokRegex
+	tokWord
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+}
+
+type queryParser struct {
+	query  string
+	tokens []queryToken
+	i      int
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...any) error {
+	return &queryError{query: p.query, pos: pos, msg: fmt.Sprintf(format, args...)}
+}
+
+func isQueryWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *queryParser) lex() error {
+	q := p.query
+	i := 0
+	for i < len(q) {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			p.tokens = append(p.tokens, queryToken{tokLParen, "(", i})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, queryToken{tokRParen, ")", i})
+			i++
+		case c == '/':
+			start := i
+			var b strings.Builder
+			i++
+			for i < len(q) && q[i] != '/' {
+				// \/ is a literal slash; other escapes belong to the regex
+				if q[i] == '\\' && i+1 < len(q) && q[i+1] == '/' {
+					i++
+				}
+				b.WriteByte(q[i])
+				i++
+			}
+			if i >= len(q) {
+				return p.errorf(start, "unterminated regex")
+			}
+			i++
+			re := b.String()
+			if i < len(q) && q[i] == 'i' {
+				re = "(?i)" + re
+				i++
+			}
+			p.tokens = append(p.tokens, queryToken{tokRegex, re, start})
+		case isQueryWordChar(c):
+			start := i
+			for i < len(q) && isQueryWordChar(q[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, queryToken{tokWord, q[start:i], start})
+		default:
+			return p.errorf(i, "unexpected %q", c)
+		}
+	}
+	p.tokens = append(p.tokens, queryToken{tokEOF, "", len(q)})
+	return nil
+}
+
+func (p *queryParser) peek() queryToken { return p.tokens[p.i] }
+
+// keyword reports whether the next token is the given operator.
+func (p *queryParser) keyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokWord && strings.EqualFold(t.text, kw)
+}
+
+func isQueryKeyword(s string) bool {
+	return strings.EqualFold(s, "AND") || strings.EqualFold(s, "OR") || strings.EqualFold(s, "NOT")
+}
+
+func (p *queryParser) parseOr() (matcher, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	terms := orMatcher{first}
+	for p.keyword("OR") {
+		p.i++
+		m, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, m)
+	}
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseAnd() (matcher, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	terms := andMatcher{first}
+	for p.keyword("AND") {
+		p.i++
+		m, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, m)
+	}
+	if len(terms) == 1 {
+		return first, nil
+	}
+	return terms, nil
+}
+
+func (p *queryParser) parseUnary() (matcher, error) {
+	if p.keyword("NOT") {
+		p.i++
+		m, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notMatcher{m}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (matcher, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokLParen:
+		p.i++
+		m, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, p.errorf(p.peek().pos, "expected \")\"")
+		}
+		p.i++
+		return m, nil
+	case tokRegex:
+		p.i++
+		re, err := regexp.Compile(t.text)
+		if err != nil {
+			return nil, p.errorf(t.pos, "bad regex: %s", err)
+		}
+		return regexMatcher{include: re}, nil
+	case tokWord:
+		if isQueryKeyword(t.text) {
+			return nil, p.errorf(t.pos, "unexpected %s", strings.ToUpper(t.text))
+		}
+		p.i++
+		pr, err := resolvePreset(t.text)
+		if err != nil {
+			return nil, p.errorf(t.pos, "unknown preset %q", t.text)
+		}
+		return compileSpec(filterSpec{preset: pr.name, pattern: pr.regex, exclude: pr.exclude})
+	case tokEOF:
+		return nil, p.errorf(t.pos, "unexpected end of query")
+	default:
+		return nil, p.errorf(t.pos, "unexpected %q", t.text)
+	}
+}
+
+// parseQuery compiles a query string into a matcher tree.
+func parseQuery(q string) (matcher, error) {
+	p := &queryParser{query: q}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	m, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t.pos, "expected AND or OR")
+	}
+	return m, nil
+}
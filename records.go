@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recordKind is how a structured line is encoded.
+type recordKind int
+
+const (
+	kindText recordKind = iota
+	kindJSON
+	kindLogfmt
+)
+
+func (k recordKind) String() string {
+	switch k {
+	case kindJSON:
+		return "json"
+	case kindLogfmt:
+		return "logfmt"
+	}
+	return "text"
+}
+
+// recordFlags are the flags for structured input, where each line is a
+// JSON object or logfmt pairs. Lines that are neither are passed through
+// untouched.
+type recordFlags struct {
+	// declared is the input format given with --json or --logfmt; lines
+	// not in it are counted in the footer. Either format is recognized
+	// whether or not one is declared.
+	declared recordKind
+	// fields projects each record down to these fields, in this order.
+	fields []string
+}
+
+// active reports whether lines need looking at as records.
+func (r recordFlags) active() bool {
+	return r.declared != kindText || len(r.fields) > 0
+}
+
+// parseRecordFlags handles --json, --logfmt and --fields.
+// Returns true if the flag was consumed, false otherwise.
+func parseRecordFlags(args []string, i *int, r *recordFlags) bool {
+	switch args[*i] {
+	case "--json":
+		r.declared = kindJSON
+		*i++
+	case "--logfmt":
+		r.declared = kindLogfmt
+		*i++
+	case "--fields":
+		v := consumeFlag(args, i, "--fields")
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				r.fields = append(r.fields, f)
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// parseRecord decodes a line holding a JSON object or logfmt pairs,
+// returning kindText if it is neither.
+func parseRecord(s string) (map[string]any, recordKind) {
+	if rec, ok := parseJSONRecord(s); ok {
+		return rec, kindJSON
+	}
+	if rec, ok := parseLogfmt(s); ok {
+		return rec, kindLogfmt
+	}
+	return nil, kindText
+}
+
+// parseJSONRecord decodes a JSON object. Numbers are kept as json.Number
+// so large IDs and exact values survive.
+func parseJSONRecord(s string) (map[string]any, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") {
+		return nil, false
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var rec map[string]any
+	if err := dec.Decode(&rec); err != nil || dec.More() {
+		return nil, false
+	}
+	return rec, true
+}
+
+// isRecord reports whether s is a record of the given kind.
+func isRecord(s string, kind recordKind) bool {
+	if kind == kindJSON {
+		s = strings.TrimSpace(s)
+		return strings.HasPrefix(s, "{") && json.Valid([]byte(s))
+	}
+	_, ok := parseLogfmt(s)
+	return ok
+}
+
+// unparsedSegment is the footer segment counting lines that weren't in
+// the declared format, like "non-json 3".
+func unparsedSegment(kind recordKind, n int) string {
+	return fmt.Sprintf("non-%s %d", kind, n)
+}
+
+// setUnparsed records the count of lines that weren't in the declared
+// format in a JSON footer.
+func (f *jsonFooter) setUnparsed(kind recordKind, n int) {
+	switch kind {
+	case kindJSON:
+		f.NonJSON = n
+	case kindLogfmt:
+		f.NonLogfmt = n
+	}
+}
+
+// lookupField finds a field by name. A dotted name that isn't a key itself
+// walks nested objects, so both {"http.status": 500} and
+// {"http": {"status": 500}} match http.status.
+func lookupField(rec map[string]any, name string) (any, bool) {
+	if v, ok := rec[name]; ok {
+		return v, true
+	}
+	parts := strings.Split(name, ".")
+	var v any = rec
+	for _, p := range parts {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// fieldString renders a value for comparison: strings as they are, other
+// values as compact JSON.
+func fieldString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return compactJSON(v)
+}
+
+// compactJSON encodes v without escaping <, > and &.
+func compactJSON(v any) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func fieldNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// whereOps are tried longest first so ">=" isn't read as ">".
+var whereOps = []string{">=", "<=", "!=", "=", ">", "<", "~"}
+
+// whereCond is one --where condition such as level=error or status>=500.
+type whereCond struct {
+	field string
+	op    string
+	value string
+	num   float64
+	// dur is set when the value is a duration like 2s, so dur>1.5s compares
+	// durations.
+	dur *time.Duration
+	re  *regexp.Regexp
+}
+
+func parseWhere(s string) (whereCond, error) {
+	at := strings.IndexAny(s, "=!<>~")
+	if at <= 0 {
+		return whereCond{}, fmt.Errorf("invalid --where %q: must be FIELD OP VALUE, e.g. level=error or 'status>=500'", s)
+	}
+	c := whereCond{field: strings.TrimSpace(s[:at])}
+	for _, op := range whereOps {
+		if strings.HasPrefix(s[at:], op) {
+			c.op = op
+			break
+		}
+	}
+	if c.op == "" {
+		return whereCond{}, fmt.Errorf("invalid --where %q: operator must be one of %s", s, strings.Join(whereOps, " "))
+	}
+	c.value = strings.TrimSpace(s[at+len(c.op):])
+	switch c.op {
+	case "~":
+		re, err := compileRegex(c.value)
+		if err != nil {
+			return whereCond{}, err
+		}
+		c.re = re
+	case ">", "<", ">=", "<=":
+		if f, err := strconv.ParseFloat(c.value, 64); err == nil {
+			c.num = f
+			break
+		}
+		d, err := time.ParseDuration(c.value)
+		if err != nil {
+			return whereCond{}, fmt.Errorf("invalid --where %q: %s needs a number or duration", s, c.op)
+		}
+		c.dur = &d
+	}
+	return c, nil
+}
+
+// eval reports whether rec satisfies the condition. A missing field never
+// does, whatever the operator.
+func (c whereCond) eval(rec map[string]any) bool {
+	v, ok := lookupField(rec, c.field)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "=":
+		return fieldString(v) == c.value
+	case "!=":
+		return fieldString(v) != c.value
+	case "~":
+		return c.re.MatchString(fieldString(v))
+	}
+	diff, ok := c.compare(v)
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case ">":
+		return diff > 0
+	case "<":
+		return diff < 0
+	case ">=":
+		return diff >= 0
+	default:
+		return diff <= 0
+	}
+}
+
+// compare returns v minus the condition's value, or false if v isn't a
+// number (or a duration, for a duration condition).
+func (c whereCond) compare(v any) (float64, bool) {
+	if c.dur != nil {
+		d, err := time.ParseDuration(fieldString(v))
+		return float64(d - *c.dur), err == nil
+	}
+	f, ok := fieldNumber(v)
+	return f - c.num, ok
+}
+
+// whereMatcher matches JSON lines satisfying every condition.
+type whereMatcher []whereCond
+
+func compileWhere(conds []string) (whereMatcher, error) {
+	var m whereMatcher
+	for _, s := range conds {
+		c, err := parseWhere(s)
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, c)
+	}
+	return m, nil
+}
+
+func (m whereMatcher) match(s string) bool {
+	rec, kind := parseRecord(s)
+	if kind == kindText {
+		return false
+	}
+	for _, c := range m {
+		if !c.eval(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// project keeps only fields of a record, in the order given, so
+// {"ts":1,"level":"error","msg":"x","trace":...} with ts,level,msg becomes
+// {"ts":1,"level":"error","msg":"x"}. logfmt stays logfmt. Other lines are
+// returned unchanged.
+func project(text string, fields []string) string {
+	if len(fields) == 0 {
+		return text
+	}
+	rec, kind := parseRecord(text)
+	switch kind {
+	case kindText:
+		return text
+	case kindLogfmt:
+		return formatLogfmt(rec, fields)
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for _, f := range fields {
+		v, ok := lookupField(rec, f)
+		if !ok {
+			continue
+		}
+		if b.Len() > 1 {
+			b.WriteByte(',')
+		}
+		b.WriteString(compactJSON(f))
+		b.WriteByte(':')
+		b.WriteString(compactJSON(v))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
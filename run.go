@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const stderrTag = "[stderr] "
+
+type runConfig struct {
+	pipe      pipeConfig
+	tagStderr bool
+	command   []string
+	// flags are the glance flags as given, recorded for rerun.
+	flags []string
+	// dir is where to run the command, or "" for the current directory.
+	dir string
+	// previous is the capture being rerun, to compare the output with.
+	previous string
+	// killGroup runs the command in its own process group, all killed if
+	// it is cancelled.
+	killGroup bool
+}
+
+// maxRerunChanges caps the lines of rerun's "new vs previous" section.
+const maxRerunChanges = 20
+
+// parseRunArgs splits "glance run [flags] -- cmd args..." into pipe flags and
+// the command. Unless the first argument is a flag or "--", every argument
+// belongs to the command, so "glance run go test ./... -- -v" runs it as is.
+func parseRunArgs(args []string) (runConfig, error) {
+	var flags []string
+	cmd := args
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		for i, a := range args {
+			if a == "--" {
+				flags, cmd = args[:i], args[i+1:]
+				break
+			}
+		}
+	}
+	return newRunConfig(flags, cmd)
+}
+
+// newRunConfig parses the glance flags of a command to run.
+func newRunConfig(flags, cmd []string) (runConfig, error) {
+	if len(cmd) == 0 {
+		return runConfig{}, fmt.Errorf("usage: glance run [flags] -- <command> [args...]")
+	}
+
+	cfg := runConfig{command: cmd, flags: flags}
+	var pipeFlags []string
+	for _, f := range flags {
+		if f == "--tag-stderr" {
+			cfg.tagStderr = true
+			continue
+		}
+		pipeFlags = append(pipeFlags, f)
+	}
+	pc, err := parsePipeArgs(pipeFlags)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.pipe = pc
+	return cfg, nil
+}
+
+func doRun(args []string) {
+	cfg, err := parseRunArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glance run: %s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(runCommand(cfg))
+}
+
+// doRerun runs a capture's command again, with its glance flags followed
+// by any given here.
+func doRerun(args []string) {
+	if len(args) < 1 || args[0] == "--" {
+		fmt.Fprintf(os.Stderr, "glance rerun: usage: glance rerun <id> [flags]\n")
+		os.Exit(1)
+	}
+	id, extra := args[0], args[1:]
+	if !validCaptureID(id) {
+		fmt.Fprintf(os.Stderr, "glance rerun: invalid capture ID: %s\n", id)
+		os.Exit(1)
+	}
+	requireCapture(id)
+	m, ok, err := readCaptureMeta(id)
+	if err != nil {
+		fatal(err.Error())
+	}
+	if !ok || len(m.Command) == 0 {
+		fmt.Fprintf(os.Stderr, "glance rerun: capture %s has no recorded command; only glance run captures can be rerun\n", id)
+		os.Exit(1)
+	}
+	flags := append(append([]string{}, m.Flags...), extra...)
+	cfg, err := newRunConfig(flags, m.Command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glance rerun: %s\n", err)
+		os.Exit(1)
+	}
+	cfg.dir = m.Dir
+	cfg.previous = id
+	os.Exit(runCommand(cfg))
+}
+
+// runResult describes how the child process finished.
+type runResult struct {
+	exitCode int
+	signal   string
+	elapsed  time.Duration
+	// previous and changes compare a rerun with the capture it reran.
+	previous string
+	changes  *captureDiff
+}
+
+// jsonChanges is the "new vs previous" comparison of a rerun.
+type jsonChanges struct {
+	Previous string     `json:"previous"`
+	Removed  int        `json:"removed"`
+	Added    int        `json:"added"`
+	Hunks    []diffHunk `json:"hunks"`
+}
+
+// footer returns the footer segments describing the child's exit.
+func (r runResult) footer() []string {
+	status := fmt.Sprintf("exit %d", r.exitCode)
+	if r.signal != "" {
+		status = "signal " + r.signal
+	}
+	return []string{status, formatDuration(r.elapsed)}
+}
+
+// addJSON records the child's exit in a JSON footer.
+func (r runResult) addJSON(f *jsonFooter) {
+	f.Command = "run"
+	exit, ms := r.exitCode, r.elapsed.Milliseconds()
+	if r.signal != "" {
+		f.Signal = r.signal
+	} else {
+		f.Exit = &exit
+	}
+	f.ElapsedMS = &ms
+	if d := r.changes; d != nil {
+		f.Changes = &jsonChanges{Previous: r.previous, Removed: d.removed, Added: d.added, Hunks: d.hunks}
+		if f.Changes.Hunks == nil {
+			f.Changes.Hunks = []diffHunk{}
+		}
+	}
+}
+
+// writeChanges prints the lines that appeared or disappeared since the
+// previous run, up to maxRerunChanges of them.
+func (r runResult) writeChanges(out *lineWriter, id string) {
+	d := r.changes
+	out.heading("new vs previous " + r.previous)
+	shown := d.write(out.w, maxRerunChanges)
+	parts := append([]string{"glance rerun of " + r.previous}, d.footer(false)...)
+	if n := d.removed + d.added; shown < n {
+		parts = append(parts, fmt.Sprintf("showing %d of %d: glance diff %s %s", shown, n, r.previous, id))
+	}
+	fmt.Fprintf(out.w, "--- %s ---\n", strings.Join(parts, " | "))
+}
+
+// runCommand spawns the command, summarizes its output like pipe mode and
+// returns the exit status glance should exit with.
+func runCommand(cfg runConfig) int {
+	// Let the child decide what an interrupt means; we still want to print
+	// the footer once it has exited.
+	signal.Notify(make(chan os.Signal, 1), os.Interrupt)
+
+	bw := bufio.NewWriter(os.Stdout)
+	lw := newLineWriter(bw, cfg.pipe.collapse, cfg.pipe.format)
+	res, rr, err := execute(context.Background(), cfg, lw, os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glance: %s\n", err)
+		return 127
+	}
+	if res.id != "" && cfg.previous != "" {
+		d := diffCaptures(cfg.previous, res.id, false)
+		rr.previous, rr.changes = cfg.previous, &d
+	}
+	writePipeFooter(lw, res, &rr)
+	if rr.changes != nil && lw.format == formatText {
+		rr.writeChanges(lw, res.id)
+	}
+	bw.Flush()
+	return rr.status()
+}
+
+// status is the exit status glance passes on for the command.
+func (r runResult) status() int {
+	if r.signal != "" {
+		return 128 + r.exitCode
+	}
+	return r.exitCode
+}
+
+// execute runs the command once, summarizing its output to lw without the
+// footer, and records it with its capture. The command is killed if ctx
+// ends first.
+func execute(ctx context.Context, cfg runConfig, lw *lineWriter, stdin io.Reader) (pipeResult, runResult, error) {
+	cmd := exec.CommandContext(ctx, cfg.command[0], cfg.command[1:]...)
+	cmd.Stdin = stdin
+	cmd.Dir = cfg.dir
+	if cfg.killGroup {
+		killGroupOnCancel(cmd)
+	}
+
+	start := time.Now()
+	out, err := startCommand(cmd, cfg.tagStderr)
+	if err != nil {
+		return pipeResult{}, runResult{}, err
+	}
+	res := summarize(cfg.pipe, out, lw)
+	rr := waitCommand(cmd)
+	rr.elapsed = time.Since(start)
+	if res.id != "" {
+		recordRun(cfg, res, rr)
+	}
+	return res, rr, nil
+}
+
+// recordRun stores the command and how it exited with the capture's
+// metadata, so it can be rerun.
+func recordRun(cfg runConfig, res pipeResult, rr runResult) {
+	m := res.meta
+	if cfg.dir != "" {
+		m.Dir = cfg.dir
+	}
+	m.Command, m.Flags, m.Previous = cfg.command, cfg.flags, cfg.previous
+	if rr.signal != "" {
+		m.Signal = rr.signal
+	} else {
+		m.Exit = &rr.exitCode
+	}
+	recordCapture(res.id, m)
+}
+
+// startCommand starts cmd and returns a reader over its combined output.
+// Without tagging, stdout and stderr share one pipe exactly like 2>&1.
+// With tagging, each stream is read line by line and stderr lines are
+// prefixed so they can be told apart.
+func startCommand(cmd *exec.Cmd, tagStderr bool) (io.Reader, error) {
+	if !tagStderr {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stdout = w
+		cmd.Stderr = w
+		if err := cmd.Start(); err != nil {
+			r.Close()
+			w.Close()
+			return nil, err
+		}
+		// The child holds its own copy; closing ours lets reads hit EOF.
+		w.Close()
+		return r, nil
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	copyLines := func(r io.Reader, prefix string) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, scanBufferSize), scanBufferSize)
+		for scanner.Scan() {
+			mu.Lock()
+			io.WriteString(pw, prefix+scanner.Text()+"\n")
+			mu.Unlock()
+		}
+		// Keep draining so the child never blocks on a full pipe.
+		io.Copy(io.Discard, r)
+	}
+	wg.Add(2)
+	go copyLines(stdout, "")
+	go copyLines(stderr, stderrTag)
+	go func() {
+		wg.Wait()
+		pw.Close()
+	}()
+	return pr, nil
+}
+
+// waitCommand waits for cmd to exit. For a signalled child, exitCode holds
+// the signal number.
+func waitCommand(cmd *exec.Cmd) runResult {
+	err := cmd.Wait()
+	if err == nil {
+		return runResult{}
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		fmt.Fprintf(os.Stderr, "glance: %s\n", err)
+		return runResult{exitCode: 1}
+	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		sig := ws.Signal()
+		return runResult{exitCode: int(sig), signal: signalName(sig)}
+	}
+	return runResult{exitCode: exitErr.ExitCode()}
+}
+
+func signalName(sig syscall.Signal) string {
+	name := sig.String()
+	if strings.HasPrefix(name, "signal ") {
+		return strings.TrimPrefix(name, "signal ")
+	}
+	return name
+}
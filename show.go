@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 const defaultAroundContext = 5
@@ -17,10 +19,21 @@ type aroundSpec struct {
 }
 
 type showConfig struct {
-	id      string
-	ranges  [][2]int
-	around  []aroundSpec
-	filters []string
+	id       string
+	ranges   [][2]int
+	around   []aroundSpec
+	match    matchFlags
+	collapse collapseMode
+	format   outputFormat
+	records  recordFlags
+	summary  string
+	// traceDepth and recordStart are as for pipe's --traces,
+	// --trace-depth and --record-start.
+	traceDepth  int
+	recordStart *regexp.Regexp
+	times       timeRange
+	// info prints the capture's metadata instead of its lines.
+	info bool
 }
 
 func parseShowArgs(args []string) (showConfig, error) {
@@ -31,7 +44,7 @@ func parseShowArgs(args []string) (showConfig, error) {
 	id := args[0]
 	args = args[1:]
 
-	if id == "" || strings.Contains(id, "/") || strings.Contains(id, "..") {
+	if !validCaptureID(id) {
 		return showConfig{}, fmt.Errorf("invalid capture ID: %s", id)
 	}
 
@@ -39,7 +52,13 @@ func parseShowArgs(args []string) (showConfig, error) {
 
 	i := 0
 	for i < len(args) {
-		if parseFilter(args, &i, &cfg.filters) {
+		if parseFilter(args, &i, &cfg.match) {
+			continue
+		}
+		if parseCollapse(args, &i, &cfg.collapse) {
+			continue
+		}
+		if parseRecordFlags(args, &i, &cfg.records) {
 			continue
 		}
 		switch args[i] {
@@ -72,10 +91,71 @@ func parseShowArgs(args []string) (showConfig, error) {
 				i += 2
 			}
 			cfg.around = append(cfg.around, aroundSpec{center: center, context: ctx})
+		case "--format":
+			f, err := parseFormatName(consumeFlag(args, &i, "--format"))
+			if err != nil {
+				return cfg, err
+			}
+			cfg.format = f
+		case "--traces":
+			cfg.traceDepth = defaultTraceDepth
+			i++
+		case "--trace-depth":
+			v := parsePositiveInt(consumeFlag(args, &i, "--trace-depth"))
+			if v <= 0 {
+				return cfg, fmt.Errorf("--trace-depth must be a positive integer")
+			}
+			cfg.traceDepth = v
+		case "--record-start":
+			re, err := compileRegex(consumeFlag(args, &i, "--record-start"))
+			if err != nil {
+				return cfg, err
+			}
+			cfg.recordStart = re
+		case "--since", "--until":
+			flag := args[i]
+			v := consumeFlag(args, &i, flag)
+			// A time of day is checked against a zero date here and taken
+			// on the capture's date later.
+			if _, _, err := parseTimeArg(v, time.Time{}); err != nil {
+				return cfg, fmt.Errorf("%s: %s", flag, err)
+			}
+			if flag == "--since" {
+				cfg.times.since = v
+			} else {
+				cfg.times.until = v
+			}
+		case "--last":
+			d, err := time.ParseDuration(consumeFlag(args, &i, "--last"))
+			if err != nil || d <= 0 {
+				return cfg, fmt.Errorf("--last must be a positive duration, like 5m or 1h30m")
+			}
+			cfg.times.last = d
+		case "--summary":
+			cfg.summary = consumeFlag(args, &i, "--summary")
+			if err := checkSummaryName(cfg.summary); err != nil {
+				return cfg, err
+			}
+		case "--info":
+			cfg.info = true
+			i++
 		default:
 			return cfg, fmt.Errorf("unknown flag: %s", args[i])
 		}
 	}
+	if cfg.summary != "" && (len(cfg.ranges) > 0 || len(cfg.around) > 0 || cfg.match.selects() || cfg.times.active()) {
+		return cfg, fmt.Errorf("--summary can't be combined with --lines, --around, filters or time ranges")
+	}
+	if cfg.times.last > 0 && cfg.times.since != "" {
+		return cfg, fmt.Errorf("--last can't be combined with --since")
+	}
+	if cfg.recordStart != nil && (cfg.summary != "" || cfg.traceDepth > 0) {
+		return cfg, fmt.Errorf("--record-start can't be combined with --summary or --traces")
+	}
+	if cfg.info && (len(cfg.ranges) > 0 || len(cfg.around) > 0 || cfg.match.selects() || cfg.times.active() ||
+		cfg.summary != "" || cfg.collapse != collapseOff || cfg.records.active() || cfg.traceDepth > 0 || cfg.recordStart != nil) {
+		return cfg, fmt.Errorf("--info can only be combined with --format")
+	}
 	return cfg, nil
 }
 
@@ -89,15 +169,17 @@ func doShow(args []string) {
 }
 
 func runShow(cfg showConfig) {
-	path := capturePath(cfg.id)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		fmt.Fprintf(os.Stderr, "glance: capture not found: %s\n", cfg.id)
-		fmt.Fprintf(os.Stderr, "Use \"glance list\" to see stored captures.\n")
-		os.Exit(1)
+	path := requireCapture(cfg.id)
+	if cfg.info {
+		showInfo(cfg)
+		return
 	}
 
+	// Collapsing alone selects every line
+	all := len(cfg.ranges) == 0 && len(cfg.around) == 0 && !cfg.match.selects() && !cfg.times.active()
+
 	// No flags → dump full output
-	if len(cfg.ranges) == 0 && len(cfg.around) == 0 && len(cfg.filters) == 0 {
+	if all && cfg.collapse == collapseOff && cfg.format == formatText && !cfg.records.active() && cfg.summary == "" {
 		f, err := os.Open(path)
 		if err != nil {
 			fatal(err.Error())
@@ -108,10 +190,10 @@ func runShow(cfg showConfig) {
 	}
 
 	// Precompute line numbers from ranges and around specs (no clamping to total)
-	lineNums := make(map[int]bool)
+	lineNums := make(map[int]showReason)
 	for _, r := range cfg.ranges {
 		for j := r[0]; j <= r[1]; j++ {
-			lineNums[j] = true
+			lineNums[j] |= reasonRange
 		}
 	}
 	for _, a := range cfg.around {
@@ -121,12 +203,28 @@ func runShow(cfg showConfig) {
 		}
 		to := a.center + a.context
 		for j := from; j <= to; j++ {
-			lineNums[j] = true
+			lineNums[j] |= reasonAround
+		}
+	}
+
+	// Resolve the time range against the capture's own timestamps, so
+	// --last counts back from its final one.
+	var from, to time.Time
+	if cfg.times.active() {
+		first, last, ok := captureTimes(path)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "glance show: no timestamps found in capture %s\n", cfg.id)
+			os.Exit(1)
+		}
+		var err error
+		if from, to, err = cfg.times.resolve(first, last); err != nil {
+			fmt.Fprintf(os.Stderr, "glance show: %s\n", err)
+			os.Exit(1)
 		}
 	}
 
 	// Compile filters
-	filters, err := compileFilters(cfg.filters)
+	filters, err := compileMatch(cfg.match)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "glance: %s\n", err)
 		os.Exit(1)
@@ -142,32 +240,212 @@ func runShow(cfg showConfig) {
 	scanner := bufio.NewScanner(f)
 	scanner.Buffer(make([]byte, scanBufferSize), scanBufferSize)
 	bw := bufio.NewWriter(os.Stdout)
+	out := newLineWriter(bw, cfg.collapse, cfg.format)
+	out.filters = filters
+	out.fields = cfg.records.fields
+	stats := newFilterStats(filters)
+	unparsed := 0
+	var sum summarizer
+	if cfg.summary != "" {
+		sum = summarizers[cfg.summary]()
+	}
+	var traces *traceGrouper
+	if cfg.traceDepth > 0 {
+		traces = newTraceGrouper(cfg.traceDepth)
+	}
+	var entries *entryGrouper
+	if cfg.recordStart != nil {
+		entries = newEntryGrouper(cfg.recordStart)
+	}
+	records := 0
 	var printed []int
 	lineNo := 0
+	// stamp is the time of the latest timestamped line, which lines
+	// without one, like continuations, inherit.
+	var stamp time.Time
+
+	process := func(l tracedLine) {
+		why := lineNums[l.num]
+		if all {
+			why |= reasonAll
+		}
+		if cfg.times.active() {
+			if t, ok := lineTime(l.text); ok {
+				stamp = t
+			}
+			if !stamp.IsZero() && contains(from, to, stamp) {
+				why |= reasonTime
+			}
+		}
+		switch {
+		case l.trace == traceHidden:
+		case l.names != nil:
+			why |= reasonFilter
+		case l.trace == traceShown:
+			why |= reasonTrace
+		}
+		if why != 0 {
+			out.write(l.num, l.text, why)
+			printed = append(printed, l.num)
+		}
+	}
+	// A filter matching anywhere in a record shows all of it.
+	addEntry := func(e entry) {
+		records++
+		names := filters.matching(e.text)
+		stats.add(e.first, names)
+		for i, line := range e.lines() {
+			process(tracedLine{num: e.first + i, text: line, names: names})
+		}
+	}
 
 	for scanner.Scan() {
 		lineNo++
 		text := scanner.Text()
-		show := lineNums[lineNo]
-		if !show {
-			show = matchesAny(filters, text)
+		if cfg.records.declared != kindText && !isRecord(text, cfg.records.declared) {
+			unparsed++
+		}
+		if sum != nil {
+			sum.add(lineNo, text)
+			continue
+		}
+		if entries != nil {
+			if e, ok := entries.push(lineNo, text); ok {
+				addEntry(e)
+			}
+			continue
+		}
+		names := filters.matching(text)
+		stats.add(lineNo, names)
+		if traces == nil {
+			process(tracedLine{num: lineNo, text: text, names: names})
+			continue
 		}
-		if show {
-			fmt.Fprintf(bw, "%d: %s\n", lineNo, text)
-			printed = append(printed, lineNo)
+		for _, l := range traces.push(lineNo, text, names) {
+			process(l)
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		fatal(err.Error())
 	}
+	if traces != nil {
+		for _, l := range traces.flush() {
+			process(l)
+		}
+	}
+	if entries != nil {
+		if e, ok := entries.flush(); ok {
+			addEntry(e)
+		}
+	}
+	var rep *summaryReport
+	if sum != nil {
+		rep = sum.report()
+		printed = writeSummary(out, rep, cfg.id)
+	}
+	out.flush()
 
 	total := lineNo
 	sort.Ints(printed)
+	if cfg.format != formatText {
+		var timeJSON *jsonTimeRange
+		if cfg.times.active() {
+			timeJSON = newJSONTimeRange(from, to)
+		}
+		f := jsonFooter{
+			Command:   "show",
+			ID:        cfg.id,
+			Total:     total,
+			Records:   records,
+			Showing:   len(printed),
+			Sections:  sectionSpans(printed),
+			Filters:   stats.json(),
+			Traces:    traces.json(),
+			Time:      timeJSON,
+			Summary:   rep,
+			Collapsed: out.folded,
+		}
+		f.setUnparsed(cfg.records.declared, unparsed)
+		f.Suppressed = stats.suppressed()
+		out.finish(f)
+		bw.Flush()
+		return
+	}
 	sections := sectionRanges(printed)
-	fmt.Fprintf(bw, "--- glance show %s | %s | showing %d | sections: %s ---\n", cfg.id, pluralLines(total), len(printed), sections)
+	extra := ""
+	for _, s := range stats.footer() {
+		extra += " | " + s
+	}
+	for _, s := range traces.footer() {
+		extra += " | " + s
+	}
+	if cfg.times.active() {
+		extra += " | time: " + formatBound(from) + " to " + formatBound(to)
+	}
+	if unparsed > 0 {
+		extra += " | " + unparsedSegment(cfg.records.declared, unparsed)
+	}
+	if rep != nil {
+		extra += " | " + strings.Join(rep.segments, " | ")
+	}
+	if out.folded > 0 {
+		extra += fmt.Sprintf(" | collapsed %d", out.folded)
+	}
+	lines := pluralLines(total)
+	if records > 0 {
+		lines += " | " + plural(records, "record")
+	}
+	fmt.Fprintf(bw, "--- glance show %s | %s | showing %d | sections: %s%s ---\n", cfg.id, lines, len(printed), sections, extra)
 	bw.Flush()
 }
 
+// jsonCaptureInfo is show --info's JSON output.
+type jsonCaptureInfo struct {
+	Version int         `json:"version"`
+	Capture jsonCapture `json:"capture"`
+}
+
+// showInfo prints what is known about a capture, one field per line.
+func showInfo(cfg showConfig) {
+	c, err := captureInfo(cfg.id, time.Now())
+	if err != nil {
+		fatal(err.Error())
+	}
+	bw := bufio.NewWriter(os.Stdout)
+	defer bw.Flush()
+	switch cfg.format {
+	case formatJSON:
+		writeJSON(bw, jsonCaptureInfo{Version: jsonSchemaVersion, Capture: c})
+		return
+	case formatJSONL:
+		writeJSON(bw, jsonHeader{Type: "header", Version: jsonSchemaVersion})
+		c.Type = "capture"
+		writeJSON(bw, c)
+		return
+	}
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(bw, "%-9s %s\n", name, value)
+		}
+	}
+	field("id", c.ID)
+	field("created", fmt.Sprintf("%s (%s)", c.Modified, formatAge(c.AgeSeconds)))
+	field("lines", fmt.Sprint(c.Lines))
+	field("bytes", fmt.Sprint(c.Bytes))
+	field("label", c.Label)
+	field("command", shellJoin(c.Command))
+	if c.Exit != nil {
+		field("exit", fmt.Sprint(*c.Exit))
+	}
+	field("signal", c.Signal)
+	field("dir", c.Dir)
+	field("filters", shellJoin(c.Filters))
+	field("previous", c.Previous)
+	if !c.recorded {
+		fmt.Fprintln(bw, "(no metadata recorded; counted from the capture file)")
+	}
+}
+
 func parseRange(s string) (int, int) {
 	idx := strings.Index(s, "-")
 	if idx < 0 {
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxItemLines caps how many lines of one summary item are printed; the
+// heading gives the full range for glance show.
+const maxItemLines = 30
+
+// summaryItem is one thing worth reading in a capture, such as a failed
+// test, with the capture lines it spans.
+type summaryItem struct {
+	Kind      string   `json:"kind"`
+	Title     string   `json:"title"`
+	Line      int      `json:"line"`
+	End       int      `json:"end"`
+	Locations []string `json:"locations,omitempty"`
+	// Counts breaks the item down, such as diagnostics by severity.
+	Counts map[string]int `json:"counts,omitempty"`
+	// lines holds up to maxItemLines lines of the item, and truncated is
+	// set if there were more.
+	lines     []ringEntry
+	truncated bool
+}
+
+// addLine extends the item to line num.
+func (it *summaryItem) addLine(num int, text string) {
+	if it.Line == 0 {
+		it.Line = num
+	}
+	it.End = num
+	if len(it.lines) < maxItemLines {
+		it.lines = append(it.lines, ringEntry{num: num, text: text})
+	} else {
+		it.truncated = true
+	}
+}
+
+// summaryReport is what a summarizer found in a capture.
+type summaryReport struct {
+	Name   string         `json:"name"`
+	Counts map[string]int `json:"counts"`
+	Items  []summaryItem  `json:"items"`
+	// segments describe the counts in the text footer.
+	segments []string
+}
+
+// summarizer digests a whole capture, line by line, into a report.
+type summarizer interface {
+	add(num int, text string)
+	report() *summaryReport
+}
+
+var summarizers = map[string]func() summarizer{
+	"gotest":      func() summarizer { return newGoTestSummarizer() },
+	"diagnostics": func() summarizer { return newDiagSummarizer() },
+	"goroutines":  func() summarizer { return newGoroutineSummarizer() },
+}
+
+func summarizerNames() string {
+	var names []string
+	for name := range summarizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func checkSummaryName(name string) error {
+	if _, ok := summarizers[name]; !ok {
+		return fmt.Errorf("unknown summary %q (available: %s)", name, summarizerNames())
+	}
+	return nil
+}
+
+// goLocation finds file:line references such as foo_test.go:42 or
+// ./pkg/x.go:10:5.
+var goLocation = regexp.MustCompile(`[\w./-]*\w\.go:\d+(?::\d+)?`)
+
+// maxLocations caps the file:line references given for one item; a
+// panic's stack trace would otherwise list every frame.
+const maxLocations = 5
+
+// findLocations returns the first distinct file:line references in lines.
+func findLocations(lines []ringEntry) []string {
+	var locs []string
+	seen := make(map[string]bool)
+	for _, l := range lines {
+		for _, loc := range goLocation.FindAllString(l.text, -1) {
+			if len(locs) == maxLocations {
+				return locs
+			}
+			if !seen[loc] {
+				seen[loc] = true
+				locs = append(locs, loc)
+			}
+		}
+	}
+	return locs
+}
+
+// countSegment renders counts like "tests: 40 passed, 2 failed", leaving
+// out zeros. It returns "" if every count is zero.
+func countSegment(label string, counts map[string]int, keys ...string) string {
+	var parts []string
+	for _, k := range keys {
+		if n := counts[k]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, k))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return label + ": " + strings.Join(parts, ", ")
+}
+
+// writeSummary prints each item as a heading followed by its lines and
+// returns the line numbers printed.
+func writeSummary(out *lineWriter, rep *summaryReport, id string) []int {
+	var printed []int
+	for _, it := range rep.Items {
+		heading := it.Title + " | " + lineSpan(it.Line, it.End)
+		if it.truncated {
+			heading += fmt.Sprintf(" (first %d shown", len(it.lines))
+			if id != "" {
+				heading += fmt.Sprintf(": glance show %s -l %d-%d", id, it.Line, it.End)
+			}
+			heading += ")"
+		}
+		if len(it.Locations) > 0 {
+			heading += " | at " + strings.Join(it.Locations, ", ")
+		}
+		out.heading(heading)
+		for _, l := range it.lines {
+			out.write(l.num, l.text, reasonSummary)
+			printed = append(printed, l.num)
+		}
+	}
+	out.flush()
+	sort.Ints(printed)
+	return printed
+}
+
+func lineSpan(from, to int) string {
+	if from == to {
+		return fmt.Sprintf("line %d", from)
+	}
+	return fmt.Sprintf("lines %d-%d", from, to)
+}
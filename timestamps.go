@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// tsISO is an RFC 3339 timestamp or its space-separated variant,
+	// optionally bracketed or as a logfmt ts=/time= field.
+	tsISO = regexp.MustCompile(`^(?:\[|(?:ts|time|timestamp)=)?(\d{4}-\d\d-\d\d)[T ](\d\d:\d\d:\d\d(?:[.,]\d+)?)(Z|[+-]\d\d:?\d\d)?`)
+	// tsSyslog is "May  1 14:02:03", which has no year.
+	tsSyslog = regexp.MustCompile(`^([A-Z][a-z]{2} [ \d]\d \d\d:\d\d:\d\d)`)
+	// tsCommonLog is the [10/Oct/2000:13:55:36 -0700] of a web server's
+	// common log format, after the host, ident and user.
+	tsCommonLog = regexp.MustCompile(`^\S+ \S+ \S+ \[(\d\d/[A-Z][a-z]{2}/\d{4}:\d\d:\d\d:\d\d [+-]\d{4})\]`)
+	// tsEpoch is Unix time in seconds, with an optional fraction, or in
+	// milliseconds.
+	tsEpoch = regexp.MustCompile(`^\[?(\d{10}(?:\.\d{1,9})?|\d{13})\b`)
+)
+
+// lineTime finds a timestamp at the start of a line.
+func lineTime(s string) (time.Time, bool) {
+	if m := tsISO.FindStringSubmatch(s); m != nil {
+		zone := m[3]
+		if zone != "" && zone != "Z" && !strings.Contains(zone, ":") {
+			zone = zone[:3] + ":" + zone[3:]
+		}
+		t, err := time.Parse("2006-01-02T15:04:05.999999999Z07:00", m[1]+"T"+strings.Replace(m[2], ",", ".", 1)+zone)
+		if zone == "" {
+			t, err = time.Parse("2006-01-02T15:04:05.999999999", m[1]+"T"+strings.Replace(m[2], ",", ".", 1))
+		}
+		return t, err == nil
+	}
+	if m := tsCommonLog.FindStringSubmatch(s); m != nil {
+		t, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[1])
+		return t, err == nil
+	}
+	if m := tsSyslog.FindStringSubmatch(s); m != nil {
+		t, err := time.Parse("Jan _2 15:04:05", m[1])
+		return t, err == nil
+	}
+	if m := tsEpoch.FindStringSubmatch(s); m != nil {
+		return epochTime(m[1])
+	}
+	return time.Time{}, false
+}
+
+func epochTime(s string) (time.Time, bool) {
+	if len(s) == 13 && !strings.Contains(s, ".") {
+		ms, err := strconv.ParseInt(s, 10, 64)
+		return time.UnixMilli(ms).UTC(), err == nil
+	}
+	sec, frac, _ := strings.Cut(s, ".")
+	n, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	ns := int64(0)
+	if frac != "" {
+		ns, _ = strconv.ParseInt((frac + "000000000")[:9], 10, 64)
+	}
+	return time.Unix(n, ns).UTC(), true
+}
+
+// timeRange is the --since/--until/--last selection of show, before it is
+// resolved against the capture's timestamps.
+type timeRange struct {
+	since, until string
+	last         time.Duration
+}
+
+func (r timeRange) active() bool {
+	return r.since != "" || r.until != "" || r.last > 0
+}
+
+// resolve turns the range into bounds, given the capture's first and last
+// timestamps. A zero bound is open.
+func (r timeRange) resolve(first, last time.Time) (from, to time.Time, err error) {
+	if r.since != "" {
+		if from, _, err = parseTimeArg(r.since, first); err != nil {
+			return from, to, err
+		}
+	}
+	if r.until != "" {
+		// --until 14:05 takes in all of 14:05, up to 14:05:59.999999999.
+		var unit time.Duration
+		if to, unit, err = parseTimeArg(r.until, first); err != nil {
+			return from, to, err
+		}
+		to = to.Add(unit - time.Nanosecond)
+	}
+	if r.last > 0 {
+		from = last.Add(-r.last)
+	}
+	return from, to, nil
+}
+
+// contains reports whether t falls within from-to, both inclusive.
+func contains(from, to, t time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+}
+
+var timeOfDay = regexp.MustCompile(`^\d\d?:\d\d(:\d\d(\.\d+)?)?$`)
+
+// parseTimeArg reads a --since or --until value: a timestamp in any format
+// lineTime knows, a date and time without seconds or zone, or a time of
+// day, which is taken on the date of ref, the capture's first timestamp.
+// unit is the span the value names, like a minute for 14:05 or a day for
+// 2024-05-01, or a nanosecond for an exact timestamp.
+func parseTimeArg(s string, ref time.Time) (t time.Time, unit time.Duration, err error) {
+	if timeOfDay.MatchString(s) {
+		parts := strings.SplitN(s, ":", 3)
+		h, _ := strconv.Atoi(parts[0])
+		m, _ := strconv.Atoi(parts[1])
+		sec, unit := 0.0, time.Minute
+		if len(parts) == 3 {
+			sec, _ = strconv.ParseFloat(parts[2], 64)
+			unit = time.Nanosecond
+			if !strings.Contains(parts[2], ".") {
+				unit = time.Second
+			}
+		}
+		y, mon, d := ref.Date()
+		return time.Date(y, mon, d, h, m, 0, int(sec*1e9), ref.Location()), unit, nil
+	}
+	for _, f := range []struct {
+		layout string
+		unit   time.Duration
+	}{
+		{"2006-01-02T15:04", time.Minute},
+		{"2006-01-02 15:04", time.Minute},
+		{"2006-01-02", 24 * time.Hour},
+	} {
+		if t, err := time.ParseInLocation(f.layout, s, ref.Location()); err == nil {
+			return t, f.unit, nil
+		}
+	}
+	if t, ok := lineTime(s); ok {
+		return t, time.Nanosecond, nil
+	}
+	return time.Time{}, 0, fmt.Errorf("invalid time %q: use e.g. 14:02, 2024-05-01T14:02:00Z or a Unix time", s)
+}
+
+// captureTimes returns the first and last timestamps in a capture.
+func captureTimes(path string) (first, last time.Time, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		fatal(err.Error())
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, scanBufferSize), scanBufferSize)
+	for scanner.Scan() {
+		if t, found := lineTime(scanner.Text()); found {
+			if !ok {
+				first, ok = t, true
+			}
+			last = t
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fatal(err.Error())
+	}
+	return first, last, ok
+}
+
+// jsonTimeRange is the resolved --since/--until/--last range of show,
+// as RFC 3339 times. An open end is omitted.
+type jsonTimeRange struct {
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+}
+
+func newJSONTimeRange(from, to time.Time) *jsonTimeRange {
+	r := &jsonTimeRange{}
+	if !from.IsZero() {
+		r.Since = from.Format(time.RFC3339Nano)
+	}
+	if !to.IsZero() {
+		r.Until = to.Format(time.RFC3339Nano)
+	}
+	return r
+}
+
+// formatBound describes one end of a time range in the footer.
+func formatBound(t time.Time) string {
+	if t.IsZero() {
+		return "…"
+	}
+	// The end of a minute or day reads better as its last second.
+	if t.Nanosecond() == 999999999 {
+		t = t.Truncate(time.Second)
+	}
+	return t.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// defaultTraceDepth is how many lines of a trace --traces shows.
+const defaultTraceDepth = 30
+
+type traceLang int
+
+const (
+	traceGo traceLang = iota
+	traceJava
+	tracePython
+)
+
+var (
+	goTraceStart = regexp.MustCompile(`^(panic: |fatal error: |goroutine \d+ \[.*\]:$)`)
+	goTraceLine  = regexp.MustCompile(`^(goroutine \d+ \[.*\]:$|\t|created by |\[signal |panic: |\.\.\.additional frames elided\.\.\.$|[\w.\-/*()\[\]{}]+\(.*\)$)`)
+	javaFrame    = regexp.MustCompile(`^\s+at \S+\(.*\)$`)
+	javaLine     = regexp.MustCompile(`^(\s+at |\s*\.\.\. \d+ (more|common frames omitted)$|Caused by: |\s*Suppressed: )`)
+	pyStart      = regexp.MustCompile(`^Traceback \(most recent call last\):$`)
+	// traceVolatile masks what differs between runs of the same trace:
+	// pointers and goroutine IDs.
+	traceVolatile = regexp.MustCompile(`0x[0-9a-fA-F]+|goroutine \d+`)
+)
+
+type traceMark int
+
+const (
+	traceNone traceMark = iota
+	// traceShown marks a line of a matched trace to print.
+	traceShown
+	// traceHidden marks the rest of a matched trace: lines past the depth,
+	// and all but the first line of a repeat.
+	traceHidden
+)
+
+// tracedLine is a line released by a traceGrouper, with the filters it
+// matched.
+type tracedLine struct {
+	num   int
+	text  string
+	names []string
+	trace traceMark
+}
+
+// traceStat is a distinct trace that matched a filter: the lines of its
+// first occurrence and how many times it occurred.
+type traceStat struct {
+	Line  int `json:"line"`
+	End   int `json:"end"`
+	Count int `json:"count"`
+}
+
+// traceGrouper holds back the lines of a stack trace (Go panic, Java
+// exception or Python traceback) until it ends. If any line of it matched
+// a filter, the whole trace is shown, up to depth lines, or just its first
+// line if the same trace was already shown.
+type traceGrouper struct {
+	depth int
+	// prev is held back in case the next line is a Java frame, which
+	// makes it the exception line starting a trace.
+	prev  *tracedLine
+	block []tracedLine
+	lang  traceLang
+	// blanks are blank lines inside a trace, kept until we know whether
+	// the trace continues after them.
+	blanks []tracedLine
+	seen   map[string]*traceStat
+	stats  []*traceStat
+}
+
+func newTraceGrouper(depth int) *traceGrouper {
+	return &traceGrouper{depth: depth, seen: make(map[string]*traceStat)}
+}
+
+// push takes the next line and returns those ready to be processed, in
+// order.
+func (g *traceGrouper) push(num int, text string, names []string) []tracedLine {
+	l := tracedLine{num: num, text: text, names: names}
+	if g.block != nil {
+		if strings.TrimSpace(text) == "" && g.lang != traceJava {
+			g.blanks = append(g.blanks, l)
+			return nil
+		}
+		if g.continues(text) {
+			g.block = append(g.block, g.blanks...)
+			g.blanks = nil
+			g.block = append(g.block, l)
+			return nil
+		}
+		if g.lang == tracePython {
+			// The unindented exception line, like "ValueError: bad
+			// input", ends a traceback.
+			g.block = append(g.block, g.blanks...)
+			g.blanks = nil
+			g.block = append(g.block, l)
+			return g.close()
+		}
+		out := g.close()
+		return append(out, g.push(num, text, names)...)
+	}
+
+	var out []tracedLine
+	switch {
+	case goTraceStart.MatchString(text):
+		g.lang = traceGo
+	case pyStart.MatchString(text):
+		g.lang = tracePython
+	case javaFrame.MatchString(text) && g.prev != nil:
+		g.lang = traceJava
+		g.block = []tracedLine{*g.prev, l}
+		g.prev = nil
+		return nil
+	default:
+		if g.prev != nil {
+			out = append(out, *g.prev)
+		}
+		g.prev = &l
+		return out
+	}
+	if g.prev != nil {
+		out = append(out, *g.prev)
+		g.prev = nil
+	}
+	g.block = []tracedLine{l}
+	return out
+}
+
+// continues reports whether text belongs to the open trace.
+func (g *traceGrouper) continues(text string) bool {
+	switch g.lang {
+	case traceGo:
+		return goTraceLine.MatchString(text)
+	case traceJava:
+		return javaLine.MatchString(text)
+	}
+	return strings.HasPrefix(text, "  ")
+}
+
+// close releases the open trace, marking its lines if it matched.
+func (g *traceGrouper) close() []tracedLine {
+	block := g.block
+	g.block = nil
+	matched := false
+	for _, l := range block {
+		if l.names != nil {
+			matched = true
+			break
+		}
+	}
+	if matched {
+		g.mark(block)
+	}
+	out := append(block, g.blanks...)
+	g.blanks = nil
+	return out
+}
+
+func (g *traceGrouper) mark(block []tracedLine) {
+	var key strings.Builder
+	for _, l := range block {
+		key.WriteString(traceVolatile.ReplaceAllString(l.text, "#"))
+		key.WriteByte('\n')
+	}
+	shown := g.depth
+	if st := g.seen[key.String()]; st != nil {
+		st.Count++
+		shown = 1
+	} else {
+		st = &traceStat{Line: block[0].num, End: block[len(block)-1].num, Count: 1}
+		g.seen[key.String()] = st
+		g.stats = append(g.stats, st)
+	}
+	for i := range block {
+		if i < shown {
+			block[i].trace = traceShown
+		} else {
+			block[i].trace = traceHidden
+		}
+	}
+}
+
+// flush releases whatever is held back at the end of the input.
+func (g *traceGrouper) flush() []tracedLine {
+	var out []tracedLine
+	if g.block != nil {
+		out = g.close()
+	}
+	if g.prev != nil {
+		out = append(out, *g.prev)
+		g.prev = nil
+	}
+	return out
+}
+
+// footer describes the matched traces, like "traces: 120-139 x5, 300-310".
+func (g *traceGrouper) footer() []string {
+	if g == nil || len(g.stats) == 0 {
+		return nil
+	}
+	var parts []string
+	for _, st := range g.stats {
+		s := fmt.Sprintf("%d-%d", st.Line, st.End)
+		if st.Count > 1 {
+			s += fmt.Sprintf(" x%d", st.Count)
+		}
+		parts = append(parts, s)
+	}
+	return []string{"traces: " + strings.Join(parts, ", ")}
+}
+
+func (g *traceGrouper) json() []traceStat {
+	if g == nil {
+		return nil
+	}
+	var out []traceStat
+	for _, st := range g.stats {
+		out = append(out, *st)
+	}
+	return out
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
+	"math/rand"
 	"os"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFormatAge(t *testing.T) {
@@ -71,12 +78,14 @@ func TestScanPresetFileCSV(t *testing.T) {
 		content string
 		want    []preset
 	}{
-		{"basic", "mypreset,error|fail,My description\n", []preset{{"mypreset", "error|fail", "My description"}}},
-		{"no desc", "mypreset,error|fail\n", []preset{{"mypreset", "error|fail", ""}}},
-		{"quoted comma", "mypreset,\"a,b\",Has comma\n", []preset{{"mypreset", "a,b", "Has comma"}}},
-		{"quoted quotes", "mypreset,\"a\"\"b\",Has quotes\n", []preset{{"mypreset", `a"b`, "Has quotes"}}},
-		{"slash in regex", "slashpre,a/b,Has slash\n", []preset{{"slashpre", "a/b", "Has slash"}}},
-		{"multiple", "one,r1,d1\ntwo,r2,d2\n", []preset{{"one", "r1", "d1"}, {"two", "r2", "d2"}}},
+		{"basic", "mypreset,error|fail,My description\n", []preset{{"mypreset", "error|fail", "My description", ""}}},
+		{"no desc", "mypreset,error|fail\n", []preset{{"mypreset", "error|fail", "", ""}}},
+		{"quoted comma", "mypreset,\"a,b\",Has comma\n", []preset{{"mypreset", "a,b", "Has comma", ""}}},
+		{"quoted quotes", "mypreset,\"a\"\"b\",Has quotes\n", []preset{{"mypreset", `a"b`, "Has quotes", ""}}},
+		{"slash in regex", "slashpre,a/b,Has slash\n", []preset{{"slashpre", "a/b", "Has slash", ""}}},
+		{"exclude column", "mypreset,error,Errs,expected\n", []preset{{"mypreset", "error", "Errs", "expected"}}},
+		{"mixed columns", "one,r1,d1\ntwo,r2,d2,x2\n", []preset{{"one", "r1", "d1", ""}, {"two", "r2", "d2", "x2"}}},
+		{"multiple", "one,r1,d1\ntwo,r2,d2\n", []preset{{"one", "r1", "d1", ""}, {"two", "r2", "d2", ""}}},
 		{"empty file", "", nil},
 	}
 	for _, tt := range tests {
@@ -128,14 +137,19 @@ func TestParsePipeArgs(t *testing.T) {
 		args []string
 		want pipeConfig
 	}{
-		{"defaults", nil, pipeConfig{n: defaultHeadTail}},
-		{"custom n", []string{"-n", "5"}, pipeConfig{n: 5}},
-		{"long head", []string{"--head", "3"}, pipeConfig{n: 3}},
-		{"long lines", []string{"--lines", "7"}, pipeConfig{n: 7}},
-		{"no store", []string{"--no-store"}, pipeConfig{n: defaultHeadTail, noStore: true}},
-		{"filter", []string{"-f", "error"}, pipeConfig{n: defaultHeadTail, filters: []string{"error"}}},
-		{"multi filter", []string{"-f", "a", "-f", "b"}, pipeConfig{n: defaultHeadTail, filters: []string{"a", "b"}}},
-		{"combined", []string{"-n", "3", "--no-store", "-f", "x"}, pipeConfig{n: 3, noStore: true, filters: []string{"x"}}},
+		{"defaults", nil, pipeConfig{head: defaultHeadTail, tail: defaultHeadTail}},
+		{"custom n", []string{"-n", "5"}, pipeConfig{head: 5, tail: 5}},
+		{"long head", []string{"--head", "3"}, pipeConfig{head: 3, tail: defaultHeadTail}},
+		{"long tail", []string{"--tail", "4"}, pipeConfig{head: defaultHeadTail, tail: 4}},
+		{"head and tail", []string{"-n", "5", "--head", "0", "--tail", "20"}, pipeConfig{head: 0, tail: 20}},
+		{"long lines", []string{"--lines", "7"}, pipeConfig{head: 7, tail: 7}},
+		{"no store", []string{"--no-store"}, pipeConfig{head: defaultHeadTail, tail: defaultHeadTail, noStore: true}},
+		{"filter", []string{"-f", "error"}, pipeConfig{head: defaultHeadTail, tail: defaultHeadTail, match: matchFlags{filters: []filterSpec{{pattern: "error"}}}}},
+		{"multi filter", []string{"-f", "a", "-f", "b"}, pipeConfig{head: defaultHeadTail, tail: defaultHeadTail, match: matchFlags{filters: []filterSpec{{pattern: "a"}, {pattern: "b"}}}}},
+		{"combined", []string{"-n", "3", "--no-store", "-f", "x"}, pipeConfig{head: 3, tail: 3, noStore: true, match: matchFlags{filters: []filterSpec{{pattern: "x"}}}}},
+		{"exclude", []string{"-f", "a", "-x", "b"}, pipeConfig{head: defaultHeadTail, tail: defaultHeadTail, match: matchFlags{filters: []filterSpec{{pattern: "a"}}, excludes: []string{"b"}}}},
+		{"context", []string{"-C", "2"}, pipeConfig{head: defaultHeadTail, tail: defaultHeadTail, before: 2, after: 2}},
+		{"before after", []string{"-B", "1", "--after-context", "4"}, pipeConfig{head: defaultHeadTail, tail: defaultHeadTail, before: 1, after: 4}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -143,14 +157,20 @@ func TestParsePipeArgs(t *testing.T) {
 			if err != nil {
 				t.Fatalf("parsePipeArgs(%v) error: %v", tt.args, err)
 			}
-			if got.n != tt.want.n {
-				t.Errorf("n = %d, want %d", got.n, tt.want.n)
+			if got.head != tt.want.head || got.tail != tt.want.tail {
+				t.Errorf("head/tail = %d/%d, want %d/%d", got.head, got.tail, tt.want.head, tt.want.tail)
 			}
 			if got.noStore != tt.want.noStore {
 				t.Errorf("noStore = %v, want %v", got.noStore, tt.want.noStore)
 			}
-			if !reflect.DeepEqual(got.filters, tt.want.filters) {
-				t.Errorf("filters = %v, want %v", got.filters, tt.want.filters)
+			if !reflect.DeepEqual(got.match.filters, tt.want.match.filters) {
+				t.Errorf("filters = %v, want %v", got.match.filters, tt.want.match.filters)
+			}
+			if !reflect.DeepEqual(got.match.excludes, tt.want.match.excludes) {
+				t.Errorf("excludes = %v, want %v", got.match.excludes, tt.want.match.excludes)
+			}
+			if got.before != tt.want.before || got.after != tt.want.after {
+				t.Errorf("context = -B %d -A %d, want -B %d -A %d", got.before, got.after, tt.want.before, tt.want.after)
 			}
 		})
 	}
@@ -164,7 +184,11 @@ func TestParsePipeArgsErrors(t *testing.T) {
 		{"missing n value", []string{"-n"}},
 		{"invalid n", []string{"-n", "abc"}},
 		{"zero n", []string{"-n", "0"}},
+		{"negative head", []string{"--head", "-1"}},
+		{"missing tail", []string{"--tail"}},
 		{"unknown flag", []string{"--bogus"}},
+		{"missing context", []string{"-C"}},
+		{"zero context", []string{"-A", "0"}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -184,7 +208,7 @@ func TestParseShowArgs(t *testing.T) {
 	}{
 		{"id only", []string{"myid"}, showConfig{id: "myid"}},
 		{"with lines", []string{"myid", "-l", "5-10"}, showConfig{id: "myid", ranges: [][2]int{{5, 10}}}},
-		{"with filter", []string{"myid", "-f", "err"}, showConfig{id: "myid", filters: []string{"err"}}},
+		{"with filter", []string{"myid", "-f", "err"}, showConfig{id: "myid", match: matchFlags{filters: []filterSpec{{pattern: "err"}}}}},
 		{"with around", []string{"myid", "-a", "25", "3"}, showConfig{id: "myid", around: []aroundSpec{{center: 25, context: 3}}}},
 		{"around default ctx", []string{"myid", "-a", "25"}, showConfig{id: "myid", around: []aroundSpec{{center: 25, context: defaultAroundContext}}}},
 	}
@@ -200,8 +224,8 @@ func TestParseShowArgs(t *testing.T) {
 			if !reflect.DeepEqual(got.ranges, tt.want.ranges) {
 				t.Errorf("ranges = %v, want %v", got.ranges, tt.want.ranges)
 			}
-			if !reflect.DeepEqual(got.filters, tt.want.filters) {
-				t.Errorf("filters = %v, want %v", got.filters, tt.want.filters)
+			if !reflect.DeepEqual(got.match.filters, tt.want.match.filters) {
+				t.Errorf("filters = %v, want %v", got.match.filters, tt.want.match.filters)
 			}
 			if !reflect.DeepEqual(got.around, tt.want.around) {
 				t.Errorf("around = %v, want %v", got.around, tt.want.around)
@@ -336,6 +360,24 @@ func TestRingBuffer(t *testing.T) {
 		}
 	})
 
+	t.Run("reset", func(t *testing.T) {
+		r := newRingBuffer(2)
+		r.push(1, "a", false)
+		r.push(2, "b", false)
+		r.push(3, "c", false)
+		r.reset()
+		if got := r.entries(); len(got) != 0 {
+			t.Errorf("after reset: len = %d, want 0", len(got))
+		}
+		if _, ok := r.push(4, "d", false); ok {
+			t.Error("should not evict after reset")
+		}
+		want := []ringEntry{{4, "d", false}}
+		if got := r.entries(); !reflect.DeepEqual(got, want) {
+			t.Errorf("entries = %v, want %v", got, want)
+		}
+	})
+
 	t.Run("no eviction before full", func(t *testing.T) {
 		r := newRingBuffer(3)
 		_, ok := r.push(1, "a", false)
@@ -376,3 +418,1541 @@ func TestParsePositiveInt(t *testing.T) {
 		}
 	}
 }
+
+func TestParseRunArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		command []string
+		n       int
+		tag     bool
+	}{
+		{"bare command", []string{"make", "test"}, []string{"make", "test"}, defaultHeadTail, false},
+		{"separator", []string{"--", "ls", "-l"}, []string{"ls", "-l"}, defaultHeadTail, false},
+		{"flags", []string{"-n", "3", "--tag-stderr", "--", "go", "test"}, []string{"go", "test"}, 3, true},
+		{"command's own separator", []string{"go", "test", "./...", "--", "-v"}, []string{"go", "test", "./...", "--", "-v"}, defaultHeadTail, false},
+		{"flags and command's separator", []string{"-n", "3", "--", "go", "test", "--", "-v"}, []string{"go", "test", "--", "-v"}, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRunArgs(tt.args)
+			if err != nil {
+				t.Fatalf("parseRunArgs(%v) error: %v", tt.args, err)
+			}
+			if !reflect.DeepEqual(got.command, tt.command) {
+				t.Errorf("command = %v, want %v", got.command, tt.command)
+			}
+			if got.pipe.head != tt.n || got.pipe.tail != tt.n {
+				t.Errorf("head/tail = %d/%d, want %d", got.pipe.head, got.pipe.tail, tt.n)
+			}
+			if got.tagStderr != tt.tag {
+				t.Errorf("tagStderr = %v, want %v", got.tagStderr, tt.tag)
+			}
+		})
+	}
+
+	for _, args := range [][]string{nil, {"-n", "3", "--"}, {"--bogus", "--", "ls"}} {
+		if _, err := parseRunArgs(args); err == nil {
+			t.Errorf("parseRunArgs(%v) expected error", args)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{1500 * time.Microsecond, "2ms"},
+		{999 * time.Millisecond, "999ms"},
+		{3420 * time.Millisecond, "3.4s"},
+		{65 * time.Second, "1m5s"},
+	}
+	for _, tt := range tests {
+		got := formatDuration(tt.d)
+		if got != tt.want {
+			t.Errorf("formatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestParseBudget(t *testing.T) {
+	tests := []struct {
+		s    string
+		want budget
+		ok   bool
+	}{
+		{"40", budget{limit: 40}, true},
+		{"2000t", budget{limit: 2000, tokens: true}, true},
+		{"0", budget{}, false},
+		{"t", budget{}, false},
+		{"abc", budget{}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseBudget(tt.s)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseBudget(%q) error = %v, want ok=%v", tt.s, err, tt.ok)
+		}
+		if got != tt.want {
+			t.Errorf("parseBudget(%q) = %+v, want %+v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetCost(t *testing.T) {
+	lines := budget{limit: 10}
+	if c := lines.cost(12345, "a long line of text"); c != 1 {
+		t.Errorf("lines cost = %d, want 1", c)
+	}
+	tokens := budget{limit: 10, tokens: true}
+	// "7: abcdefgh\n" is 12 bytes
+	if c := tokens.cost(7, "abcdefgh"); c != 3 {
+		t.Errorf("tokens cost = %d, want 3", c)
+	}
+}
+
+func TestSelectGroups(t *testing.T) {
+	ones := func(n int) []int {
+		c := make([]int, n)
+		for i := range c {
+			c[i] = 1
+		}
+		return c
+	}
+	kept := func(keep []bool) []int {
+		var out []int
+		for i, k := range keep {
+			if k {
+				out = append(out, i)
+			}
+		}
+		return out
+	}
+
+	t.Run("fits", func(t *testing.T) {
+		got := kept(selectGroups(ones(5), 5))
+		if !reflect.DeepEqual(got, []int{0, 1, 2, 3, 4}) {
+			t.Errorf("kept = %v", got)
+		}
+	})
+
+	t.Run("edges then sample", func(t *testing.T) {
+		got := kept(selectGroups(ones(100), 8))
+		want := []int{0, 1, 2, 26, 73, 97, 98, 99}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("kept = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("edges only", func(t *testing.T) {
+		got := kept(selectGroups(ones(20), 4))
+		want := []int{0, 1, 18, 19}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("kept = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("zero budget", func(t *testing.T) {
+		if got := kept(selectGroups(ones(10), 0)); len(got) != 0 {
+			t.Errorf("kept = %v, want none", got)
+		}
+	})
+
+	t.Run("skips groups that do not fit", func(t *testing.T) {
+		got := kept(selectGroups([]int{5, 1, 1}, 2))
+		if !reflect.DeepEqual(got, []int{1, 2}) {
+			t.Errorf("kept = %v, want [1 2]", got)
+		}
+	})
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"errors", "errors"},
+		{"-p", "-p"},
+		{"", "''"},
+		{"a b", "'a b'"},
+		{"(?i)error|fail", "'(?i)error|fail'"},
+		{"it's", `'it'\''s'`},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.s); got != tt.want {
+			t.Errorf("shellQuote(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarKey(t *testing.T) {
+	same := [][2]string{
+		{"Waiting for db... attempt 1", "Waiting for db... attempt 250"},
+		{"2026-02-19T14:30:22Z health ok", "2026-02-19T14:30:27Z health ok"},
+		{"alloc at 0x7ffd1234", "alloc at 0xc000a1"},
+		{"commit 3f9a1c2b77 pushed", "commit d41d8cd98f pushed"},
+	}
+	for _, p := range same {
+		if similarKey(p[0]) != similarKey(p[1]) {
+			t.Errorf("similarKey(%q) != similarKey(%q)", p[0], p[1])
+		}
+	}
+	if similarKey("connected to db") == similarKey("connected to cache") {
+		t.Error("different words should not compare equal")
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	write := func(mode collapseMode, lines []ringEntry) (string, int) {
+		var b strings.Builder
+		bw := bufio.NewWriter(&b)
+		lw := newLineWriter(bw, mode, formatText)
+		for _, l := range lines {
+			lw.write(l.num, l.text, 0)
+		}
+		lw.flush()
+		bw.Flush()
+		return b.String(), lw.folded
+	}
+	lines := []ringEntry{
+		{num: 1, text: "start"},
+		{num: 2, text: "wait 1"},
+		{num: 3, text: "wait 1"},
+		{num: 4, text: "wait 2"},
+		{num: 5, text: "wait 3"},
+		{num: 9, text: "wait 3"},
+		{num: 10, text: "done"},
+	}
+
+	t.Run("off", func(t *testing.T) {
+		got, folded := write(collapseOff, lines)
+		want := "1: start\n2: wait 1\n3: wait 1\n4: wait 2\n5: wait 3\n9: wait 3\n10: done\n"
+		if got != want || folded != 0 {
+			t.Errorf("got %q (folded %d), want %q", got, folded, want)
+		}
+	})
+
+	t.Run("exact", func(t *testing.T) {
+		got, folded := write(collapseExact, lines)
+		want := "1: start\n2-3: (x2) wait 1\n4: wait 2\n5: wait 3\n9: wait 3\n10: done\n"
+		if got != want || folded != 1 {
+			t.Errorf("got %q (folded %d), want %q", got, folded, want)
+		}
+	})
+
+	t.Run("similar", func(t *testing.T) {
+		got, folded := write(collapseSimilar, lines)
+		// 5 and 9 are not adjacent in the input, so they stay separate
+		want := "1: start\n2-5: (x4) wait 1\n9: wait 3\n10: done\n"
+		if got != want || folded != 3 {
+			t.Errorf("got %q (folded %d), want %q", got, folded, want)
+		}
+	})
+}
+
+func TestClusterer(t *testing.T) {
+	c := newClusterer(defaultClusterSim)
+	lines := []string{
+		"GET /api/users/1 200 3ms",
+		"user alice logged in",
+		"GET /api/users/2 200 5ms",
+		"user bob logged in",
+		"panic: nil map",
+		"user carol logged in",
+		"",
+	}
+	for i, l := range lines {
+		c.add(i+1, l)
+	}
+	got := c.sorted()
+	if len(got) != 3 {
+		t.Fatalf("got %d clusters, want 3", len(got))
+	}
+	want := []struct {
+		template    string
+		count       int
+		first, last int
+	}{
+		{"user <*> logged in", 3, 2, 6},
+		{"GET <*> <*> <*>", 2, 1, 3},
+		{"panic: nil map", 1, 5, 5},
+	}
+	for i, w := range want {
+		cl := got[i]
+		if tpl := strings.Join(cl.template, " "); tpl != w.template {
+			t.Errorf("cluster %d template = %q, want %q", i, tpl, w.template)
+		}
+		if cl.count != w.count || cl.first != w.first || cl.last != w.last {
+			t.Errorf("cluster %d = count %d lines %d-%d, want count %d lines %d-%d",
+				i, cl.count, cl.first, cl.last, w.count, w.first, w.last)
+		}
+	}
+	if got[0].example != "user alice logged in" {
+		t.Errorf("example = %q", got[0].example)
+	}
+}
+
+func TestParseClustersArgs(t *testing.T) {
+	cfg, err := parseClustersArgs([]string{"myid", "--sim", "0.7", "--rare", "3"})
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if cfg.id != "myid" || cfg.sim != 0.7 || cfg.rare != 3 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+	for _, args := range [][]string{nil, {"a/b"}, {"myid", "--sim", "2"}, {"myid", "--rare", "0"}, {"myid", "--bogus"}} {
+		if _, err := parseClustersArgs(args); err == nil {
+			t.Errorf("parseClustersArgs(%v) expected error", args)
+		}
+	}
+}
+
+func TestFilterSet(t *testing.T) {
+	errs, _ := getBuiltinPreset("errors")
+	fs, err := compileMatch(matchFlags{
+		filters: []filterSpec{
+			{preset: errs.name, pattern: errs.regex, exclude: errs.exclude},
+			{pattern: "timeout"},
+		},
+		excludes: []string{"retrying"},
+	})
+	if err != nil {
+		t.Fatalf("compileMatch error: %v", err)
+	}
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"ERROR db connection refused", true},
+		{"request timeout", true},
+		{"ok: 0 errors", false},
+		{"no failures, 0 failed", false},
+		{"ERROR writing to stderr", true},
+		{"ErrNotFound is expected here", true},
+		// The preset's exclusions don't veto other filters
+		{"0 errors, but a timeout", true},
+		// Global exclusions veto everything
+		{"timeout, retrying", false},
+		{"all good", false},
+	}
+	for _, tt := range tests {
+		if got := fs.matching(tt.line) != nil; got != tt.want {
+			t.Errorf("match(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+
+	if _, err := compileMatch(matchFlags{excludes: []string{"["}}); err == nil {
+		t.Error("invalid exclude regex should error")
+	}
+
+	names := map[string][]string{
+		"ERROR: request timeout":  {errs.name, "timeout"},
+		"request timeout":         {"timeout"},
+		"timeout, retrying":       nil,
+		"all good":                nil,
+		"ERROR db conn refused":   {errs.name},
+		"0 errors, but a timeout": {"timeout"},
+	}
+	for line, want := range names {
+		if got := fs.matching(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("matching(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		line  string
+		want  bool
+	}{
+		{"/db/", "db down", true},
+		{"/DB/i", "db down", true},
+		{"/DB/", "db down", false},
+		{"errors AND /db/", "ERROR db down", true},
+		{"errors AND /db/", "ERROR cache down", false},
+		{"errors AND /db/ AND NOT /timeout/", "ERROR db timeout", false},
+		{"/a/ OR /b/ AND /c/", "a", true},
+		{"(/a/ OR /b/) AND /c/", "a", false},
+		{"NOT NOT /a/", "a", true},
+		{"not /a/ and /b/", "b", true},
+		{`/a\/b/`, "x a/b y", true},
+		// Preset exclusions carry into queries
+		{"errors", "0 errors", false},
+	}
+	for _, tt := range tests {
+		m, err := parseQuery(tt.query)
+		if err != nil {
+			t.Errorf("parseQuery(%q) error: %v", tt.query, err)
+			continue
+		}
+		if got := m.match(tt.line); got != tt.want {
+			t.Errorf("query %q match(%q) = %v, want %v", tt.query, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{"", 0, "unexpected end"},
+		{"errors AND", 10, "unexpected end"},
+		{"(errors", 7, `expected ")"`},
+		{"errors /db/", 7, "expected AND or OR"},
+		{"/db", 0, "unterminated regex"},
+		{"nosuchpreset", 0, "unknown preset"},
+		{"errors AND /(/", 11, "bad regex"},
+		{"errors & /db/", 7, "unexpected"},
+		{"AND /db/", 0, "unexpected AND"},
+	}
+	for _, tt := range tests {
+		_, err := parseQuery(tt.query)
+		qe, ok := err.(*queryError)
+		if !ok {
+			t.Errorf("parseQuery(%q) error = %v, want queryError", tt.query, err)
+			continue
+		}
+		if qe.pos != tt.pos || !strings.Contains(qe.msg, tt.msg) {
+			t.Errorf("parseQuery(%q) = %q at %d, want %q at %d", tt.query, qe.msg, qe.pos, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestFilterModes(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags []string
+		line  string
+		want  bool
+	}{
+		{"regex by default", []string{"-f", "a.b"}, "axb", true},
+		{"fixed", []string{"-F", "-f", "a.b[0]"}, "got a.b[0] here", true},
+		{"fixed no regex", []string{"-F", "-f", "a.b"}, "axb", false},
+		{"word", []string{"-w", "-f", "err"}, "err: x", true},
+		{"word not inside", []string{"-w", "-f", "err"}, "stderr", false},
+		{"icase", []string{"-i", "-f", "error"}, "ERROR", true},
+		{"per filter", []string{"-fFi", "A.B", "-f", "x.y"}, "a.b", true},
+		{"per filter only", []string{"-fFi", "A.B", "-f", "x.y"}, "xzy", true},
+		{"global after filter", []string{"-f", "a.b", "-F"}, "axb", false},
+		{"exclude uses mode", []string{"-F", "-f", "a", "-x", "a.b"}, "a.b", false},
+		{"presets unaffected", []string{"-F", "-p", "errors"}, "fatal error", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m matchFlags
+			for i := 0; i < len(tt.flags); {
+				if !parseFilter(tt.flags, &i, &m) {
+					t.Fatalf("flag not consumed: %s", tt.flags[i])
+				}
+			}
+			fs, err := compileMatch(m)
+			if err != nil {
+				t.Fatalf("compileMatch error: %v", err)
+			}
+			if got := fs.matching(tt.line) != nil; got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLiteralSet(t *testing.T) {
+	ls := newLiteralSet([]literalPattern{
+		{name: "he", text: "he"},
+		{name: "she", text: "she"},
+		{name: "hers", text: "hers"},
+		{name: "HIS", text: "HIS", icase: true},
+		{name: "cat", text: "cat", word: true},
+	})
+	found := func(s string) []string {
+		var names []string
+		ls.each(s, func(i int) bool {
+			names = append(names, ls.patterns[i].name)
+			return true
+		})
+		sort.Strings(names)
+		return names
+	}
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"ushers", []string{"he", "hers", "she"}},
+		{"this is his", []string{"HIS"}},
+		{"concat cat!", []string{"cat"}},
+		{"concatenate", nil},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		if got := found(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("each(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+	if !ls.match("xhex") || ls.match("xyz") {
+		t.Error("match mismatch")
+	}
+
+	// Scanning reuses the set's state rather than allocating per line.
+	var words []literalPattern
+	for _, w := range strings.Fields("timeout refused reset closed broken denied dropped failed lost stalled") {
+		words = append(words, literalPattern{name: w, text: w})
+	}
+	exact := newLiteralSet(words)
+	line := "reset refused closed broken denied dropped failed lost stalled"
+	if n := testing.AllocsPerRun(100, func() { exact.each(line, func(int) bool { return true }) }); n != 0 {
+		t.Errorf("each allocated %v times per line, want 0", n)
+	}
+	mixed := newLiteralSet(append(words, literalPattern{name: "err", text: "ERR", icase: true}))
+	line = "Err: " + line
+	if n := testing.AllocsPerRun(100, func() { mixed.each(line, func(int) bool { return true }) }); n != 0 {
+		t.Errorf("each with a case-insensitive literal allocated %v times per line, want 0", n)
+	}
+	if !exact.match("read timeout") || exact.match("ok") {
+		t.Error("state leaked between lines")
+	}
+}
+
+func TestPipeResultWindows(t *testing.T) {
+	tests := []struct {
+		res  pipeResult
+		want []string
+	}{
+		{pipeResult{total: 500, head: 20, tail: 5}, []string{"head: 1-20", "tail: 496-500"}},
+		{pipeResult{total: 500, head: 0, tail: 5}, []string{"head: none", "tail: 496-500"}},
+		{pipeResult{total: 500, head: 3, tail: 0}, []string{"head: 1-3", "tail: none"}},
+		{pipeResult{total: 10, head: 8, tail: 5}, []string{"head: 1-8", "tail: 9-10"}},
+		{pipeResult{total: 5, head: 8, tail: 1}, []string{"head: 1-5", "tail: none"}},
+		{pipeResult{total: 2, head: 1, tail: 3}, []string{"head: 1", "tail: 2"}},
+	}
+	for _, tt := range tests {
+		if got := tt.res.windows(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("windows(%+v) = %v, want %v", tt.res, got, tt.want)
+		}
+	}
+}
+
+func TestSectionSpans(t *testing.T) {
+	got := sectionSpans([]int{1, 2, 3, 7, 9, 10})
+	want := [][2]int{{1, 3}, {7, 7}, {9, 10}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sectionSpans = %v, want %v", got, want)
+	}
+	if got := sectionSpans(nil); got != nil {
+		t.Errorf("sectionSpans(nil) = %v, want nil", got)
+	}
+}
+
+func TestParseFormatName(t *testing.T) {
+	for name, want := range map[string]outputFormat{"text": formatText, "json": formatJSON, "jsonl": formatJSONL} {
+		got, err := parseFormatName(name)
+		if err != nil || got != want {
+			t.Errorf("parseFormatName(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"", "JSON", "yaml"} {
+		if _, err := parseFormatName(name); err == nil {
+			t.Errorf("parseFormatName(%q) expected error", name)
+		}
+	}
+}
+
+func TestShowReasonNames(t *testing.T) {
+	if got := (reasonHead | reasonFilter).names(); !reflect.DeepEqual(got, []string{"head", "filter"}) {
+		t.Errorf("names = %v", got)
+	}
+	if got := showReason(0).names(); got == nil || len(got) != 0 {
+		t.Errorf("no reasons should be an empty list, got %#v", got)
+	}
+}
+
+func TestLineWriterJSON(t *testing.T) {
+	fs, err := compileMatch(matchFlags{filters: []filterSpec{{pattern: "wait"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(format outputFormat) string {
+		var b strings.Builder
+		bw := bufio.NewWriter(&b)
+		lw := newLineWriter(bw, collapseExact, format)
+		lw.filters = fs
+		lw.write(1, "start", reasonHead)
+		lw.write(2, "wait", reasonFilter)
+		lw.write(3, "wait", reasonContext)
+		lw.flush()
+		lw.finish(jsonFooter{Command: "pipe", Total: 3, Showing: 3, Sections: [][2]int{{1, 3}}, Collapsed: lw.folded})
+		bw.Flush()
+		return b.String()
+	}
+
+	got := write(formatJSON)
+	want := `{"version":1,"lines":[` +
+		`{"n":1,"text":"start","reasons":["head"]},` +
+		`{"n":2,"end":3,"count":2,"text":"wait","reasons":["filter","context"],"filters":["wait"]}],` +
+		`"footer":{"command":"pipe","total":3,"showing":3,"sections":[[1,3]],"collapsed":1}}` + "\n"
+	if got != want {
+		t.Errorf("json:\n got %s\nwant %s", got, want)
+	}
+
+	got = write(formatJSONL)
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("jsonl: got %d records, want 4:\n%s", len(lines), got)
+	}
+	if lines[0] != `{"type":"header","version":1}` {
+		t.Errorf("jsonl header = %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], `{"type":"line","n":1,`) || !strings.HasPrefix(lines[3], `{"type":"footer",`) {
+		t.Errorf("jsonl records out of order:\n%s", got)
+	}
+}
+
+func TestFilterStatsFooter(t *testing.T) {
+	fs, err := compileMatch(matchFlags{
+		filters: []filterSpec{{pattern: "b"}, {pattern: "a"}, {pattern: "b"}},
+		queries: []string{"/z/"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := newFilterStats(fs)
+	for i, line := range []string{"a", "ab", "c", "b", "a"} {
+		st.add(i+1, fs.matching(line))
+	}
+	want := []string{"b: 2 (first 2, last 4)", "a: 3 (first 1, last 5)", "/z/: 0"}
+	if got := st.footer(); !reflect.DeepEqual(got, want) {
+		t.Errorf("footer = %v, want %v", got, want)
+	}
+	st.add(9, []string{"/z/"})
+	if got := st.footer()[2]; got != "/z/: 1 (line 9)" {
+		t.Errorf("single match = %q", got)
+	}
+	if got := newFilterStats(&filterSet{}).footer(); got != nil {
+		t.Errorf("no filters should add no segments, got %v", got)
+	}
+}
+
+func TestWhere(t *testing.T) {
+	rec, ok := parseJSONRecord(`{"level":"error","status":503,"http":{"method":"GET"},"user.id":"42","ok":false,"id":12345678901234567890}`)
+	if !ok {
+		t.Fatal("parseJSONRecord failed")
+	}
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{"level=error", true},
+		{"level=ERROR", false},
+		{"level!=info", true},
+		{"status>=500", true},
+		{"status>503", false},
+		{"status<=503", true},
+		{"status=503", true},
+		{"http.method=GET", true},
+		{"user.id=42", true},
+		{"user.id>40", true},
+		{"ok=false", true},
+		{"id=12345678901234567890", true},
+		{"level~^err", true},
+		{"level~(?i)ERR", true},
+		{"missing!=x", false},
+		{"level>1", false},
+		{" level = error ", true},
+	}
+	for _, tt := range tests {
+		c, err := parseWhere(tt.cond)
+		if err != nil {
+			t.Errorf("parseWhere(%q) error: %v", tt.cond, err)
+			continue
+		}
+		if got := c.eval(rec); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.cond, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"level", "=error", "status>=high", "a!b", "msg~["} {
+		if _, err := parseWhere(bad); err == nil {
+			t.Errorf("parseWhere(%q) expected error", bad)
+		}
+	}
+
+	for _, line := range []string{"plain", `{"level":`, `{"level":"error"} {}`, `["level"]`} {
+		if _, ok := parseJSONRecord(line); ok {
+			t.Errorf("parseJSONRecord(%q) should fail", line)
+		}
+	}
+}
+
+func TestWhereFilters(t *testing.T) {
+	alone, err := compileMatch(matchFlags{where: []string{"level=error", "status>=500"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alone.matching(`{"level":"error","status":500}`) == nil || alone.matching(`{"level":"error","status":404}`) != nil {
+		t.Error("--where conditions should all hold")
+	}
+	if got := alone.matching(`{"level":"error","status":502}`); !reflect.DeepEqual(got, []string{"level=error, status>=500"}) {
+		t.Errorf("matching = %v", got)
+	}
+
+	narrowed, err := compileMatch(matchFlags{filters: []filterSpec{{pattern: "db"}}, where: []string{"level=error"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		`{"level":"error","msg":"db down"}`: true,
+		`{"level":"info","msg":"db up"}`:    false,
+		`{"level":"error","msg":"disk"}`:    false,
+		`db plain text`:                     false,
+	}
+	for line, want := range tests {
+		if got := narrowed.matching(line) != nil; got != want {
+			t.Errorf("match(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestProject(t *testing.T) {
+	line := `{"ts":"10:00","level":"error","msg":"a <b>","http":{"status":503},"trace":"long"}`
+	tests := []struct {
+		fields []string
+		want   string
+	}{
+		{nil, line},
+		{[]string{"level", "ts"}, `{"level":"error","ts":"10:00"}`},
+		{[]string{"msg", "http.status", "nope"}, `{"msg":"a <b>","http.status":503}`},
+		{[]string{"nope"}, `{}`},
+	}
+	for _, tt := range tests {
+		if got := project(line, tt.fields); got != tt.want {
+			t.Errorf("project(%v) = %s, want %s", tt.fields, got, tt.want)
+		}
+	}
+	if got := project("not json", []string{"msg"}); got != "not json" {
+		t.Errorf("non-JSON line changed: %q", got)
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		line string
+		want map[string]any
+	}{
+		{`level=warn msg="slow query" dur=2.3s`, map[string]any{"level": "warn", "msg": "slow query", "dur": "2.3s"}},
+		{`  a=1   b=two  `, map[string]any{"a": "1", "b": "two"}},
+		{`msg="say \"hi\"\n" path=C:\\x`, map[string]any{"msg": "say \"hi\"\n", "path": `C:\\x`}},
+		{`k= cached level=info`, map[string]any{"k": "", "cached": true, "level": "info"}},
+		{`level=info cached msg=hi`, map[string]any{"level": "info", "cached": true, "msg": "hi"}},
+		{`url=http://x/?a=b&c=d`, map[string]any{"url": "http://x/?a=b&c=d"}},
+		{`a=1 a=2`, map[string]any{"a": "2"}},
+		{`msg="unicode \u00e9"`, map[string]any{"msg": "unicode é"}},
+	}
+	for _, tt := range tests {
+		got, ok := parseLogfmt(tt.line)
+		if !ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseLogfmt(%q) = %v, %v; want %v", tt.line, got, ok, tt.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"",
+		"plain text line",
+		"panic: runtime error",
+		"ERROR connecting to db host=x",
+		"host=x is down again",
+		"done ok=1",
+		`msg="unterminated`,
+		`msg="a"b`,
+		`a=x"y`,
+		`=value`,
+		`msg="bad \q escape"`,
+		`{"level":"error"}`,
+	} {
+		if rec, ok := parseLogfmt(bad); ok {
+			t.Errorf("parseLogfmt(%q) = %v, should fail", bad, rec)
+		}
+	}
+
+	if _, kind := parseRecord(`{"a":1}`); kind != kindJSON {
+		t.Errorf("JSON line kind = %v", kind)
+	}
+	if _, kind := parseRecord(`a=1`); kind != kindLogfmt {
+		t.Errorf("logfmt line kind = %v", kind)
+	}
+	if _, kind := parseRecord(`hello`); kind != kindText {
+		t.Errorf("text line kind = %v", kind)
+	}
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	rec, _ := parseLogfmt(`level=warn msg="slow query" dur=2.3s cached empty= q="a=b" nl="x\ny"`)
+	got := formatLogfmt(rec, []string{"msg", "level", "cached", "empty", "q", "nl", "missing"})
+	want := `msg="slow query" level=warn cached empty="" q="a=b" nl="x\ny"`
+	if got != want {
+		t.Errorf("formatLogfmt = %s, want %s", got, want)
+	}
+	if got := project(`level=warn msg="slow query" dur=2.3s`, []string{"dur", "msg"}); got != `dur=2.3s msg="slow query"` {
+		t.Errorf("project logfmt = %s", got)
+	}
+}
+
+func TestWhereDurations(t *testing.T) {
+	rec, _ := parseLogfmt(`dur=2.3s took=150ms n=7`)
+	tests := map[string]bool{
+		"dur>1s":      true,
+		"dur>=2300ms": true,
+		"dur<2s":      false,
+		"took<1s":     true,
+		"took>0.1":    false,
+		"n>5":         true,
+		"n>1s":        false,
+	}
+	for cond, want := range tests {
+		c, err := parseWhere(cond)
+		if err != nil {
+			t.Errorf("parseWhere(%q) error: %v", cond, err)
+			continue
+		}
+		if got := c.eval(rec); got != want {
+			t.Errorf("%q: got %v, want %v", cond, got, want)
+		}
+	}
+}
+
+func summarizeGoTest(input string) *summaryReport {
+	s := newGoTestSummarizer()
+	for i, line := range strings.Split(strings.TrimSuffix(input, "\n"), "\n") {
+		s.add(i+1, line)
+	}
+	return s.report()
+}
+
+func TestGoTestSummarizer(t *testing.T) {
+	t.Run("plain", func(t *testing.T) {
+		rep := summarizeGoTest("--- FAIL: TestBad (0.00s)\n" +
+			"    a_test.go:4: want 1, got 2\n" +
+			"--- FAIL: TestSub (0.00s)\n" +
+			"    --- FAIL: TestSub/one (0.01s)\n" +
+			"        a_test.go:6: boom\n" +
+			"FAIL\n" +
+			"FAIL\texample.com/gt/a\t0.002s\n" +
+			"ok  \texample.com/gt/c\t0.002s\n" +
+			"?   \texample.com/gt/d\t[no test files]\n" +
+			"FAIL\n")
+		if len(rep.Items) != 2 {
+			t.Fatalf("items = %+v, want TestBad and TestSub/one", rep.Items)
+		}
+		it := rep.Items[0]
+		if it.Title != "FAIL TestBad (example.com/gt/a, 0.00s)" || it.Line != 1 || it.End != 2 {
+			t.Errorf("first item = %+v", it)
+		}
+		if !reflect.DeepEqual(it.Locations, []string{"a_test.go:4"}) {
+			t.Errorf("locations = %v", it.Locations)
+		}
+		if it := rep.Items[1]; it.Title != "FAIL TestSub/one (example.com/gt/a, 0.01s)" || it.Line != 4 || it.End != 5 {
+			t.Errorf("subtest item = %+v", it)
+		}
+		want := []string{"packages: 1 ok, 1 failed, 1 no tests", "tests: 3 failed"}
+		if !reflect.DeepEqual(rep.segments, want) {
+			t.Errorf("segments = %q, want %q", rep.segments, want)
+		}
+		if rep.Counts["packages_no_tests"] != 1 || rep.Counts["tests_failed"] != 3 {
+			t.Errorf("counts = %v", rep.Counts)
+		}
+	})
+
+	t.Run("verbose", func(t *testing.T) {
+		rep := summarizeGoTest("=== RUN   TestOK\n" +
+			"    a_test.go:2: noise from a passing test\n" +
+			"--- PASS: TestOK (0.00s)\n" +
+			"=== RUN   TestBad\n" +
+			"    a_test.go:4: some log\n" +
+			"    a_test.go:4: want 1, got 2\n" +
+			"--- FAIL: TestBad (0.00s)\n" +
+			"=== RUN   TestSkip\n" +
+			"    a_test.go:9: later\n" +
+			"--- SKIP: TestSkip (0.00s)\n" +
+			"FAIL\n" +
+			"FAIL\texample.com/gt/a\t0.003s\n")
+		if len(rep.Items) != 1 {
+			t.Fatalf("items = %+v", rep.Items)
+		}
+		if it := rep.Items[0]; it.Line != 5 || it.End != 7 || len(it.lines) != 3 {
+			t.Errorf("item should start at the test's output: %+v", it)
+		}
+		if want := "tests: 1 passed, 1 failed, 1 skipped"; rep.segments[1] != want {
+			t.Errorf("segments = %q", rep.segments)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		rep := summarizeGoTest(`{"Action":"start","Package":"example.com/gt/a"}` + "\n" +
+			`{"Action":"run","Package":"example.com/gt/a","Test":"TestBad"}` + "\n" +
+			`{"Action":"output","Package":"example.com/gt/a","Test":"TestBad","Output":"=== RUN   TestBad\n"}` + "\n" +
+			`{"Action":"output","Package":"example.com/gt/a","Test":"TestBad","Output":"    a_test.go:4: want 1, got 2\n"}` + "\n" +
+			`{"Action":"output","Package":"example.com/gt/a","Test":"TestBad","Output":"--- FAIL: TestBad (0.00s)\n"}` + "\n" +
+			`{"Action":"fail","Package":"example.com/gt/a","Test":"TestBad","Elapsed":0}` + "\n" +
+			`{"Action":"output","Package":"example.com/gt/a","Output":"FAIL\n"}` + "\n" +
+			`{"Action":"output","Package":"example.com/gt/a","Output":"FAIL\texample.com/gt/a\t0.003s\n"}` + "\n" +
+			`{"Action":"fail","Package":"example.com/gt/a","Elapsed":0.003}` + "\n")
+		if len(rep.Items) != 1 {
+			t.Fatalf("items = %+v", rep.Items)
+		}
+		it := rep.Items[0]
+		if it.Title != "FAIL TestBad (example.com/gt/a, 0.00s)" || it.Line != 4 || it.End != 5 {
+			t.Errorf("item = %+v", it)
+		}
+		if it.lines[0].text != "    a_test.go:4: want 1, got 2" {
+			t.Errorf("lines should hold the decoded output: %q", it.lines[0].text)
+		}
+	})
+
+	t.Run("build failure", func(t *testing.T) {
+		rep := summarizeGoTest("# example.com/gt/b [example.com/gt/b.test]\n" +
+			"b/b_test.go:3:40: cannot use \"s\" (untyped string constant) as int value\n" +
+			"FAIL\texample.com/gt/b [build failed]\n" +
+			"FAIL\n")
+		if len(rep.Items) != 1 || rep.Items[0].Title != "BUILD FAILED example.com/gt/b" || rep.Items[0].End != 2 {
+			t.Fatalf("items = %+v", rep.Items)
+		}
+		if !reflect.DeepEqual(rep.Items[0].Locations, []string{"b/b_test.go:3:40"}) {
+			t.Errorf("locations = %v", rep.Items[0].Locations)
+		}
+		if rep.segments[0] != "packages: 1 build failed" {
+			t.Errorf("segments = %q", rep.segments)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		var b strings.Builder
+		b.WriteString("--- FAIL: TestPanic (0.00s)\npanic: boom [recovered]\n\tpanic: boom\n\ngoroutine 7 [running]:\n")
+		for i := 0; i < 20; i++ {
+			fmt.Fprintf(&b, "testing.tRunner.func1()\n\t/usr/local/go/src/testing/testing.go:%d +0x1f\n", 1000+i)
+		}
+		b.WriteString("FAIL\texample.com/gt/a\t0.003s\n")
+		rep := summarizeGoTest(b.String())
+		it := rep.Items[0]
+		if it.End != 45 || len(it.lines) != maxItemLines || !it.truncated {
+			t.Errorf("item = line %d-%d, %d lines kept, truncated %v", it.Line, it.End, len(it.lines), it.truncated)
+		}
+		if len(it.Locations) != maxLocations {
+			t.Errorf("locations = %v", it.Locations)
+		}
+	})
+
+	t.Run("nothing found", func(t *testing.T) {
+		rep := summarizeGoTest("hello\nworld\n")
+		if len(rep.Items) != 0 || rep.segments[0] != "no go test results found" {
+			t.Errorf("report = %+v", rep)
+		}
+	})
+}
+
+func TestDiagSummarizer(t *testing.T) {
+	s := newDiagSummarizer()
+	for i, line := range []string{
+		"# example.com/app",
+		"./main.go:10:5: undefined: run",
+		"src/a.ts(3,5): error TS2322: Type 'string' is not assignable to type 'number'.",
+		"src/a.ts:7:1 - warning TS6133: 'x' is declared but its value is never read.",
+		"foo.c:12:3: warning: unused variable 'y' [-Wunused-variable]",
+		"foo.c:4:10: note: declared here",
+		"foo.c:12:3: warning: unused variable 'y' [-Wunused-variable]",
+		"error[E0425]: cannot find value `x` in this scope",
+		" --> src/main.rs:2:5",
+		"error: aborting due to 1 previous error",
+		"",
+		"/home/u/web/app.js",
+		"  1:10  error    'x' is defined but never used  no-unused-vars",
+		"",
+		"lib.js:5:3: Missing semicolon. [Warning/semi]",
+		"Built at 12:30:01: done",
+		"see https://example.com:8080/x",
+	} {
+		s.add(i+1, line)
+	}
+	rep := s.report()
+
+	var titles []string
+	for _, it := range rep.Items {
+		titles = append(titles, it.Title)
+	}
+	want := []string{
+		"main.go (1 error)",
+		"src/a.ts (1 error, 1 warning)",
+		"foo.c (1 warning, 1 note)",
+		"src/main.rs (1 error)",
+		"/home/u/web/app.js (1 error)",
+		"lib.js (1 warning)",
+	}
+	if !reflect.DeepEqual(titles, want) {
+		t.Fatalf("titles = %q, want %q", titles, want)
+	}
+
+	foo := rep.Items[2]
+	if foo.Line != 5 || foo.End != 6 || len(foo.lines) != 2 {
+		t.Errorf("foo.c item = %+v", foo)
+	}
+	if got := foo.lines[0].text; got != "12:3  warning  unused variable 'y' [-Wunused-variable] (x2)" {
+		t.Errorf("repeated row = %q", got)
+	}
+	if rust := rep.Items[3]; rust.Line != 8 || rust.lines[0].text != "2:5  error  E0425: cannot find value `x` in this scope" {
+		t.Errorf("rust item = %+v", rust)
+	}
+	if got := rep.Items[5].lines[0].text; got != "5:3  warning  Missing semicolon.  semi" {
+		t.Errorf("eslint unix row = %q", got)
+	}
+	if rep.Counts["error"] != 4 || rep.Counts["files"] != 6 || rep.Counts["duplicates"] != 1 {
+		t.Errorf("counts = %v", rep.Counts)
+	}
+	if want := "diagnostics: 4 errors, 3 warnings, 1 note in 6 files, 1 repeat dropped"; rep.segments[0] != want {
+		t.Errorf("segment = %q, want %q", rep.segments[0], want)
+	}
+
+	if rep := newDiagSummarizer().report(); rep.segments[0] != "no diagnostics found" {
+		t.Errorf("empty segment = %q", rep.segments)
+	}
+}
+
+func groupTraces(depth int, lines []string, match string) []tracedLine {
+	g := newTraceGrouper(depth)
+	var out []tracedLine
+	for i, line := range lines {
+		var names []string
+		if strings.Contains(line, match) {
+			names = []string{match}
+		}
+		out = append(out, g.push(i+1, line, names)...)
+	}
+	return append(out, g.flush()...)
+}
+
+func traceMarks(lines []tracedLine) string {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(".SH"[l.trace : l.trace+1])
+	}
+	return b.String()
+}
+
+func TestTraceGrouper(t *testing.T) {
+	goPanic := []string{
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/app/main.go:10 +0x25",
+		"exit status 2",
+	}
+	tests := []struct {
+		name  string
+		lines []string
+		depth int
+		want  string
+	}{
+		{"go panic", append([]string{"start"}, goPanic...), 30, ".SSSSS."},
+		{"depth", goPanic, 2, "SSHHH."},
+		{"trailing blank not in trace", []string{"panic: boom", "\tx.go:1", "", "done"}, 30, "SS.."},
+		{"python", []string{
+			"Traceback (most recent call last):",
+			`  File "app.py", line 2, in main`,
+			`    raise ValueError("boom")`,
+			"ValueError: boom",
+			"next",
+		}, 30, "SSSS."},
+		{"java", []string{
+			"request failed",
+			"java.lang.IllegalStateException: boom",
+			"\tat com.x.Service.run(Service.java:12)",
+			"Caused by: java.io.IOException: disk",
+			"\t... 2 more",
+			"next",
+		}, 30, ".SSSS."},
+	}
+	for _, tt := range tests {
+		got := groupTraces(tt.depth, tt.lines, "boom")
+		if len(got) != len(tt.lines) {
+			t.Errorf("%s: released %d of %d lines", tt.name, len(got), len(tt.lines))
+			continue
+		}
+		for i, l := range got {
+			if l.num != i+1 || l.text != tt.lines[i] {
+				t.Errorf("%s: line %d released as %d %q", tt.name, i+1, l.num, l.text)
+			}
+		}
+		if marks := traceMarks(got); marks != tt.want {
+			t.Errorf("%s: marks = %s, want %s", tt.name, marks, tt.want)
+		}
+	}
+
+	t.Run("unmatched trace untouched", func(t *testing.T) {
+		if marks := traceMarks(groupTraces(30, goPanic, "nothing")); marks != "......" {
+			t.Errorf("marks = %s", marks)
+		}
+	})
+
+	t.Run("repeats", func(t *testing.T) {
+		// The same panic, with different pointers
+		a := append([]string(nil), goPanic...)
+		a[3] = "main.main(0xc000099999)"
+		b := append([]string(nil), goPanic...)
+		b[3] = "main.main(0xc000012345)"
+		g := newTraceGrouper(30)
+		var out []tracedLine
+		for i, line := range append(append(a, b...), a...) {
+			var names []string
+			if strings.Contains(line, "boom") {
+				names = []string{"boom"}
+			}
+			out = append(out, g.push(i+1, line, names)...)
+		}
+		out = append(out, g.flush()...)
+		if marks := traceMarks(out); marks != "SSSSS.SHHHH.SHHHH." {
+			t.Errorf("marks = %s", marks)
+		}
+		if want := []string{"traces: 1-5 x3"}; !reflect.DeepEqual(g.footer(), want) {
+			t.Errorf("footer = %q, want %q", g.footer(), want)
+		}
+	})
+}
+
+func TestGoroutineSummarizer(t *testing.T) {
+	dump := []string{
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/app/main.go:30 +0x175",
+		"",
+		"goroutine 6 [chan receive, 12 minutes]:",
+		"main.worker(0xc000012345)",
+		"\t/app/main.go:8 +0x1d",
+		"created by main.main in goroutine 1",
+		"\t/app/main.go:22 +0x6b",
+		"",
+		"goroutine 7 [chan receive, 3 minutes]:",
+		"main.worker(0xc000099999)",
+		"\t/app/main.go:8 +0x1d",
+		"created by main.main in goroutine 1",
+		"\t/app/main.go:22 +0x6b",
+		"",
+		"goroutine 8 [select]:",
+		"main.sel(...)",
+		"\t/app/main.go:11",
+		"",
+		"goroutine 9 [chan receive]:",
+		"main.worker(0xc000011111)",
+		"\t/app/other.go:8 +0x1d",
+		"exit status 2",
+	}
+	s := newGoroutineSummarizer()
+	for i, line := range dump {
+		s.add(i+1, line)
+	}
+	rep := s.report()
+
+	var titles []string
+	for _, it := range rep.Items {
+		titles = append(titles, it.Title)
+	}
+	want := []string{
+		"PANIC in goroutine 1 [running]: panic: boom",
+		"2 goroutines [chan receive, 3-12 minutes] in main.worker",
+		"1 goroutine [select] in main.sel",
+		"1 goroutine [chan receive] in main.worker",
+	}
+	if !reflect.DeepEqual(titles, want) {
+		t.Fatalf("titles = %q, want %q", titles, want)
+	}
+	if it := rep.Items[0]; it.Kind != "panic" || it.Line != 1 || it.End != 5 || len(it.lines) != 4 {
+		t.Errorf("panic item = %+v", it)
+	}
+	if it := rep.Items[1]; it.Line != 7 || it.End != 11 || it.Counts["goroutines"] != 2 {
+		t.Errorf("worker group = %+v", it)
+	}
+	if it := rep.Items[3]; it.End != 25 {
+		t.Errorf("exit status should end the last stack: %+v", it)
+	}
+	wantSegs := []string{
+		"goroutines: 5 in 4 distinct stacks",
+		"states: 3 chan receive, 1 running, 1 select",
+		"panic in goroutine 1",
+	}
+	if !reflect.DeepEqual(rep.segments, wantSegs) {
+		t.Errorf("segments = %q, want %q", rep.segments, wantSegs)
+	}
+
+	if rep := newGoroutineSummarizer().report(); rep.segments[0] != "no goroutine dump found" {
+		t.Errorf("empty segments = %q", rep.segments)
+	}
+}
+
+func TestEntryGrouper(t *testing.T) {
+	g := newEntryGrouper(regexp.MustCompile(`^\d{4}-`))
+	var got []entry
+	for i, line := range []string{
+		"preamble",
+		"2024-05-01 INFO a",
+		"2024-05-01 ERROR b",
+		"  detail 1",
+		"  detail 2",
+		"2024-05-01 INFO c",
+	} {
+		if e, ok := g.push(i+1, line); ok {
+			got = append(got, e)
+		}
+	}
+	if e, ok := g.flush(); ok {
+		got = append(got, e)
+	}
+	want := []entry{
+		{1, 1, "preamble"},
+		{2, 2, "2024-05-01 INFO a"},
+		{3, 5, "2024-05-01 ERROR b\n  detail 1\n  detail 2"},
+		{6, 6, "2024-05-01 INFO c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if lines := got[2].lines(); len(lines) != 3 || lines[2] != "  detail 2" {
+		t.Errorf("lines = %q", lines)
+	}
+	if _, ok := newEntryGrouper(regexp.MustCompile(`x`)).flush(); ok {
+		t.Error("empty input should have no record")
+	}
+
+	if c := (budget{limit: 10}).cost(7, "a\nb\nc"); c != 3 {
+		t.Errorf("record line cost = %d, want 3", c)
+	}
+}
+
+func TestLineTime(t *testing.T) {
+	utc := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for _, tc := range []struct {
+		line string
+		want time.Time
+	}{
+		{"2024-05-01T14:02:03Z INFO ok", utc("2024-05-01T14:02:03Z")},
+		{"2024-05-01T14:02:03.25+02:00 x", utc("2024-05-01T12:02:03.25Z")},
+		{"2024-05-01 14:02:03,500 WARN x", utc("2024-05-01T14:02:03.5Z")},
+		{"[2024-05-01T14:02:03Z] x", utc("2024-05-01T14:02:03Z")},
+		{"ts=2024-05-01T14:02:03Z level=info", utc("2024-05-01T14:02:03Z")},
+		{"May  1 14:02:03 host sshd[1]: x", time.Date(0, 5, 1, 14, 2, 3, 0, time.UTC)},
+		{`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 2326`, utc("2000-10-10T20:55:36Z")},
+		{"1714572123 event", utc("2024-05-01T14:02:03Z")},
+		{"1714572123.5 event", utc("2024-05-01T14:02:03.5Z")},
+		{"1714572123500 event", utc("2024-05-01T14:02:03.5Z")},
+	} {
+		got, ok := lineTime(tc.line)
+		if !ok || !got.Equal(tc.want) {
+			t.Errorf("lineTime(%q) = %v, %v, want %v", tc.line, got, ok, tc.want)
+		}
+	}
+	for _, line := range []string{"", "  at foo", "12345 items", "INFO 2024-05-01T14:02:03Z late"} {
+		if _, ok := lineTime(line); ok {
+			t.Errorf("lineTime(%q) found a timestamp", line)
+		}
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	first := time.Date(2024, 5, 1, 23, 50, 0, 0, time.UTC)
+	last := time.Date(2024, 5, 2, 0, 10, 0, 0, time.UTC)
+
+	from, to, err := timeRange{since: "23:55", until: "2024-05-02 00:05"}.resolve(first, last)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Equal(time.Date(2024, 5, 1, 23, 55, 0, 0, time.UTC)) || !to.Equal(time.Date(2024, 5, 2, 0, 5, 59, 999999999, time.UTC)) {
+		t.Errorf("resolve = %v to %v", from, to)
+	}
+	if !contains(from, to, time.Date(2024, 5, 2, 0, 5, 30, 0, time.UTC)) || contains(from, to, last) {
+		t.Error("until should take in the whole minute")
+	}
+
+	// --until covers the whole of the unit it names.
+	for until, want := range map[string]time.Time{
+		"00:05":                time.Date(2024, 5, 1, 0, 5, 59, 999999999, time.UTC),
+		"00:05:30":             time.Date(2024, 5, 1, 0, 5, 30, 999999999, time.UTC),
+		"00:05:30.5":           time.Date(2024, 5, 1, 0, 5, 30, 500000000, time.UTC),
+		"2024-05-02":           time.Date(2024, 5, 2, 23, 59, 59, 999999999, time.UTC),
+		"2024-05-02T00:05":     time.Date(2024, 5, 2, 0, 5, 59, 999999999, time.UTC),
+		"2024-05-02T00:05:00Z": time.Date(2024, 5, 2, 0, 5, 0, 0, time.UTC),
+	} {
+		if _, to, _ := (timeRange{until: until}).resolve(first, last); !to.Equal(want) {
+			t.Errorf("--until %s resolved to %v, want %v", until, to, want)
+		}
+	}
+	if s := formatBound(time.Date(2024, 5, 2, 0, 5, 59, 999999999, time.UTC)); s != "2024-05-02T00:05:59Z" {
+		t.Errorf("formatBound = %s", s)
+	}
+
+	from, to, _ = timeRange{last: 5 * time.Minute}.resolve(first, last)
+	if !from.Equal(time.Date(2024, 5, 2, 0, 5, 0, 0, time.UTC)) || !to.IsZero() {
+		t.Errorf("--last resolved to %v to %v", from, to)
+	}
+	if !contains(from, to, last) || contains(from, to, first) {
+		t.Error("--last should count back from the final timestamp")
+	}
+
+	if _, _, err := parseTimeArg("yesterday", first); err == nil {
+		t.Error("expected an error for an unknown time")
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	split := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, "")
+	}
+	kept := func(lines []string, marks []bool) string {
+		var b strings.Builder
+		for i, l := range lines {
+			if !marks[i] {
+				b.WriteString(l)
+			}
+		}
+		return b.String()
+	}
+	lcs := func(a, b []string) int {
+		dp := make([][]int, len(a)+1)
+		for i := range dp {
+			dp[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					dp[i][j] = dp[i+1][j+1] + 1
+				} else {
+					dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+				}
+			}
+		}
+		return dp[0][0]
+	}
+	check := func(as, bs string) {
+		a, b := split(as), split(bs)
+		removed, added := diffLines(a, b)
+		ka, kb := kept(a, removed), kept(b, added)
+		if ka != kb || len(ka) != lcs(a, b) {
+			t.Errorf("diff(%q, %q) kept %q and %q, want a common subsequence of length %d", as, bs, ka, kb, lcs(a, b))
+		}
+	}
+	for _, tc := range [][2]string{
+		{"", ""}, {"abc", ""}, {"", "abc"}, {"abc", "abc"},
+		{"abcabba", "cbabac"}, {"abcdef", "azcdxf"}, {"ab", "ba"}, {"aaaa", "aa"},
+	} {
+		check(tc[0], tc[1])
+	}
+	rng := rand.New(rand.NewSource(1))
+	random := func() string {
+		b := make([]byte, rng.Intn(30))
+		for i := range b {
+			b[i] = "abcd"[rng.Intn(4)]
+		}
+		return string(b)
+	}
+	for range 500 {
+		check(random(), random())
+	}
+
+	removed, added := diffLines(split("abcdef"), split("abXdefY"))
+	want := []diffHunk{{A: 3, AEnd: 3, B: 3, BEnd: 3}, {A: 7, AEnd: 6, B: 7, BEnd: 7}}
+	if got := diffHunks(removed, added); !reflect.DeepEqual(got, want) {
+		t.Errorf("hunks = %+v, want %+v", got, want)
+	}
+	if s := want[0].String() + ", " + want[1].String(); s != "-3 +3, +7" {
+		t.Errorf("hunk strings = %q", s)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"2024-05-01T14:02:03.123Z INFO started in 1.5s", "2024-05-02 09:00:00 INFO started in 230ms"},
+		{"ok  \tgithub.com/x/y\t0.012s", "ok  \tgithub.com/x/y\t1.4s"},
+		{"sshd[1234]: accepted pid=99", "sshd[87]: accepted pid=1000"},
+		{"panic at 0xc000012345", "panic at 0xc0000abcde"},
+		{"wrote /tmp/go-build12345/b001/out", "wrote /tmp/go-build99/b001/out"},
+		{"/var/folders/ab/cd12/T/TestX123/f.txt", "/var/folders/zz/yy34/T/TestX987/f.txt"},
+		{"job 3f2b1c9e-aaaa-4bbb-8ccc-0123456789ab done", "job 00000000-1111-2222-3333-444444444444 done"},
+		{"listening on 127.0.0.1:41235 and [::1]:41236", "listening on 127.0.0.1:8080 and [::1]:8081"},
+		{"bound to port 5000", "bound to port 6000"},
+	} {
+		if a, b := builtinRules.apply(pair[0]), builtinRules.apply(pair[1]); a != b {
+			t.Errorf("normalized lines differ: %q vs %q", a, b)
+		}
+	}
+	if builtinRules.apply("exit 1 file a.go") == builtinRules.apply("exit 2 file a.go") {
+		t.Error("plain numbers should not be masked")
+	}
+}
+
+func TestParseWatchArgs(t *testing.T) {
+	cfg, err := parseWatchArgs([]string{"--every", "2s", "-n", "3", "--until", "ready", "--tag-stderr", "--timeout", "1m", "--", "kubectl", "get", "pods"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.every != 2*time.Second || cfg.timeout != time.Minute || cfg.until.String() != "ready" || cfg.untilExit != -1 {
+		t.Errorf("cfg = %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.run.command, []string{"kubectl", "get", "pods"}) || cfg.run.pipe.head != 3 || !cfg.run.tagStderr {
+		t.Errorf("run = %+v", cfg.run)
+	}
+	if !reflect.DeepEqual(cfg.run.flags, []string{"-n", "3", "--tag-stderr"}) {
+		t.Errorf("recorded flags = %q", cfg.run.flags)
+	}
+
+	cfg, _ = parseWatchArgs([]string{"--until-exit", "0", "--", "go", "test"})
+	if cfg.untilExit != 0 || cfg.every != defaultWatchEvery || cfg.timeout != defaultWatchTimeout {
+		t.Errorf("defaults = %+v", cfg)
+	}
+
+	for _, args := range [][]string{
+		{"go", "test"},
+		{"--every", "2s", "--"},
+		{"--every", "soon", "--", "ls"},
+		{"--timeout", "-1s", "--", "ls"},
+		{"--until", "(", "--", "ls"},
+		{"--until-exit", "x", "--", "ls"},
+		{"--no-store", "--", "ls"},
+		{"--format", "json", "--", "ls"},
+	} {
+		if _, err := parseWatchArgs(args); err == nil {
+			t.Errorf("parseWatchArgs(%q) should fail", args)
+		}
+	}
+}
+
+func TestBaselineMatching(t *testing.T) {
+	b := &baseline{names: []string{"proj"}, fingerprints: make(map[string]bool)}
+	for _, line := range []string{"foo.go:12:3: warning: deprecated call to Bar", "  note: took 0.3s", ""} {
+		if fp := fingerprint(line); fp != "" {
+			b.fingerprints[fp] = true
+		}
+	}
+	if len(b.fingerprints) != 2 {
+		t.Errorf("fingerprints = %v", b.fingerprints)
+	}
+	if !b.contains("foo.go:80:1: warning: deprecated call to Bar") {
+		t.Error("a moved warning should still be in the baseline")
+	}
+	if !b.contains("foo.go:1:1: warning: deprecated call to Bar\n\n note: took 12ms") {
+		t.Error("a record whose lines are all known should be in the baseline")
+	}
+	if b.contains("foo.go:1:1: warning: deprecated call to Baz") || b.contains("foo.go:1:1: warning: deprecated call to Bar\nerror: new") {
+		t.Error("new lines should not be in the baseline")
+	}
+
+	fs, err := compileMatch(matchFlags{filters: []filterSpec{{pattern: "warning|error"}}, baseline: b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := newFilterStats(fs)
+	for i, line := range []string{"foo.go:1:1: warning: deprecated call to Bar", "b.go:2: error: new", "foo.go:3:9: warning: deprecated call to Bar"} {
+		stats.add(i+1, fs.matching(line))
+	}
+	want := []string{"warning|error: 1 (line 2)", "baseline proj: 2 suppressed"}
+	if got := stats.footer(); !reflect.DeepEqual(got, want) {
+		t.Errorf("footer = %q, want %q", got, want)
+	}
+}
+
+func TestCaptureDescribe(t *testing.T) {
+	exit := 1
+	for _, tc := range []struct {
+		c    jsonCapture
+		want string
+	}{
+		{jsonCapture{}, ""},
+		{jsonCapture{Label: "nightly"}, "nightly"},
+		{jsonCapture{Command: []string{"go", "test", "./..."}, Exit: &exit}, "go test ./... (exit 1)"},
+		{jsonCapture{Label: "ci", Command: []string{"sleep", "9"}, Signal: "KILL"}, "ci: sleep 9 (signal KILL)"},
+	} {
+		if got := tc.c.describe(); got != tc.want {
+			t.Errorf("describe(%+v) = %q, want %q", tc.c, got, tc.want)
+		}
+	}
+}
+
+func TestBudgetSampler(t *testing.T) {
+	s := newBudgetSampler(budget{limit: 10})
+	maxHeld := 0
+	for n := 1; n <= 100000; n += 2 {
+		// Every match brings one line of context.
+		s.add(middleLine{num: n, text: "ERROR", owner: n})
+		s.add(middleLine{num: n + 1, text: "ctx", owner: n})
+		maxHeld = max(maxHeld, s.held)
+	}
+	if maxHeld > budgetHold*10+2 {
+		t.Errorf("held up to %d lines, want at most %d", maxHeld, budgetHold*10+2)
+	}
+	kept, hidden := s.finish(10)
+	if len(kept) != 10 {
+		t.Errorf("kept %d lines, want 10", len(kept))
+	}
+	if shown := len(kept) / 2; shown+hidden != 50000 {
+		t.Errorf("shown %d + hidden %d matches, want 50000", shown, hidden)
+	}
+	if kept[0].num != 1 || kept[len(kept)-1].num != 100000 {
+		t.Errorf("first and last kept = %d, %d; want the first and last match", kept[0].num, kept[len(kept)-1].num)
+	}
+}
+
+func TestGoroutineMethodFrames(t *testing.T) {
+	dump := []string{
+		"goroutine 5 [select]:",
+		"main.(*Server).loop(0xc000012345, 0x1)",
+		"\t/app/server.go:40 +0x1d",
+		"",
+		"goroutine 6 [select]:",
+		"main.(*Server).loop(0xc000099999, 0x2)",
+		"\t/app/server.go:40 +0x1d",
+		"",
+		"goroutine 7 [IO wait]:",
+		"main.(*Server).serve(0xc000012345)",
+		"\t/app/server.go:60 +0x2a",
+	}
+	s := newGoroutineSummarizer()
+	for i, line := range dump {
+		s.add(i+1, line)
+	}
+	var titles []string
+	for _, it := range s.report().Items {
+		titles = append(titles, it.Title)
+	}
+	want := []string{
+		"2 goroutines [select] in main.(*Server).loop",
+		"1 goroutine [IO wait] in main.(*Server).serve",
+	}
+	if !reflect.DeepEqual(titles, want) {
+		t.Errorf("titles = %q, want %q", titles, want)
+	}
+}
+
+func TestPlural(t *testing.T) {
+	for _, tt := range []struct {
+		n    int
+		noun string
+		want string
+	}{
+		{1, "error", "1 error"},
+		{3, "error", "3 errors"},
+		{1, "more match", "1 more match"},
+		{2, "more match", "2 more matches"},
+		{2, "box", "2 boxes"},
+	} {
+		if got := plural(tt.n, tt.noun); got != tt.want {
+			t.Errorf("plural(%d, %q) = %q, want %q", tt.n, tt.noun, got, tt.want)
+		}
+	}
+}
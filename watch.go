@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultWatchEvery   = 5 * time.Second
+	defaultWatchTimeout = 10 * time.Minute
+)
+
+type watchConfig struct {
+	run     runConfig
+	every   time.Duration
+	timeout time.Duration
+	// until and untilExit are the stop conditions; untilExit is -1 when
+	// not set.
+	until     *regexp.Regexp
+	untilExit int
+}
+
+// parseWatchArgs takes the watch flags out of "glance watch [flags] -- cmd"
+// and leaves the rest to parseRunArgs.
+func parseWatchArgs(args []string) (watchConfig, error) {
+	cfg := watchConfig{every: defaultWatchEvery, timeout: defaultWatchTimeout, untilExit: -1}
+	sep := -1
+	for i, a := range args {
+		if a == "--" {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 || sep == len(args)-1 {
+		return cfg, fmt.Errorf("usage: glance watch [--every D] [--until REGEX] [--timeout D] [flags] -- <command> [args...]")
+	}
+
+	duration := func(flag, v string) (time.Duration, error) {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("%s must be a positive duration, like 5s or 2m", flag)
+		}
+		return d, nil
+	}
+	var rest []string
+	i := 0
+	for i < sep {
+		var err error
+		switch args[i] {
+		case "--every":
+			cfg.every, err = duration("--every", consumeFlag(args[:sep], &i, "--every"))
+		case "--timeout":
+			cfg.timeout, err = duration("--timeout", consumeFlag(args[:sep], &i, "--timeout"))
+		case "--until":
+			cfg.until, err = compileRegex(consumeFlag(args[:sep], &i, "--until"))
+		case "--until-exit":
+			v := consumeFlag(args[:sep], &i, "--until-exit")
+			cfg.untilExit, err = strconv.Atoi(v)
+			if err != nil || cfg.untilExit < 0 {
+				err = fmt.Errorf("--until-exit must be an exit code")
+			}
+		default:
+			rest = append(rest, args[i])
+			i++
+		}
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	run, err := newRunConfig(rest, args[sep+1:])
+	if err != nil {
+		return cfg, err
+	}
+	if run.pipe.noStore {
+		return cfg, fmt.Errorf("--no-store can't be used with watch, which compares stored runs")
+	}
+	if run.pipe.format != formatText {
+		return cfg, fmt.Errorf("--format can't be used with watch")
+	}
+	cfg.run = run
+	return cfg, nil
+}
+
+func doWatch(args []string) {
+	cfg, err := parseWatchArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "glance watch: %s\n", err)
+		os.Exit(1)
+	}
+	os.Exit(runWatch(cfg))
+}
+
+// watcher prints what changed between consecutive runs, folding runs
+// that changed nothing into one line.
+type watcher struct {
+	out *lineWriter
+	// quiet are the numbers of the unchanged runs not yet reported.
+	quiet []int
+}
+
+func (w *watcher) changed(run int, id string, rr runResult, d captureDiff) {
+	if len(d.hunks) == 0 {
+		w.quiet = append(w.quiet, run)
+		return
+	}
+	w.flushQuiet()
+	parts := append([]string{fmt.Sprintf("run %d: %s", run, id)}, rr.footer()...)
+	parts = append(parts, d.footer(false)[0])
+	w.out.heading(strings.Join(parts, " | "))
+	shown := d.write(w.out.w, maxRerunChanges)
+	if n := d.removed + d.added; shown < n {
+		fmt.Fprintf(w.out.w, "... %d more: glance diff %s %s\n", n-shown, rr.previous, id)
+	}
+}
+
+func (w *watcher) flushQuiet() {
+	switch n := len(w.quiet); {
+	case n == 1:
+		w.out.heading(fmt.Sprintf("run %d: no changes", w.quiet[0]))
+	case n > 1:
+		w.out.heading(fmt.Sprintf("runs %d-%d: no changes", w.quiet[0], w.quiet[n-1]))
+	}
+	w.quiet = nil
+}
+
+// runWatch runs the command every cfg.every until a condition is met or
+// the timeout expires. The first run is summarized like glance run; later
+// runs only show the lines that changed since the run before.
+func runWatch(cfg watchConfig) int {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	// The command runs in its own process group, out of reach of the
+	// terminal's interrupt, so pass it on by cancelling.
+	var interrupted atomic.Bool
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		interrupted.Store(true)
+		cancel()
+	}()
+
+	start := time.Now()
+	bw := bufio.NewWriter(os.Stdout)
+	defer bw.Flush()
+	w := &watcher{out: newLineWriter(bw, collapseOff, formatText)}
+	discard := newLineWriter(bufio.NewWriter(io.Discard), cfg.run.pipe.collapse, formatText)
+
+	var prev string
+	var rr runResult
+	stop, status := "", 0
+	run := 0
+	// timedOut stops on the timeout, which is a failure only when waiting
+	// for a condition.
+	timedOut := func() {
+		stop = "timeout after " + formatDuration(cfg.timeout)
+		status = rr.status()
+		if cfg.until != nil || cfg.untilExit >= 0 {
+			status = 124
+		}
+	}
+	for stop == "" {
+		run++
+		rc := cfg.run
+		rc.previous = prev
+		rc.killGroup = true
+		lw := discard
+		if run == 1 {
+			lw = newLineWriter(bw, rc.pipe.collapse, formatText)
+		}
+		var res pipeResult
+		var err error
+		res, rr, err = execute(ctx, rc, lw, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "glance: %s\n", err)
+			return 127
+		}
+		if run == 1 {
+			writePipeFooter(lw, res, &rr)
+		} else {
+			rr.previous = prev
+			w.changed(run, res.id, rr, diffCaptures(prev, res.id, false))
+		}
+		bw.Flush()
+		prev = res.id
+
+		switch m := untilMatch(cfg.until, res.id); {
+		case interrupted.Load():
+			stop, status = "interrupted", 130
+		case m != "":
+			stop = fmt.Sprintf("run %d matched %s", run, m)
+		case cfg.untilExit >= 0 && rr.signal == "" && rr.exitCode == cfg.untilExit:
+			stop = fmt.Sprintf("run %d exited %d", run, rr.exitCode)
+		case ctx.Err() != nil:
+			timedOut()
+		default:
+			select {
+			case <-time.After(cfg.every):
+			case <-ctx.Done():
+				if interrupted.Load() {
+					stop, status = "interrupted", 130
+				} else {
+					timedOut()
+				}
+			}
+		}
+	}
+	w.flushQuiet()
+	fmt.Fprintf(bw, "--- glance watch | last id=%s | %s | stopped: %s | %s ---\n",
+		prev, plural(run, "run"), stop, formatDuration(time.Since(start)))
+	return status
+}
+
+// untilMatch returns where re first matches a capture, like
+// `"deployed" on line 12`, or "" if it doesn't.
+func untilMatch(re *regexp.Regexp, id string) string {
+	if re == nil {
+		return ""
+	}
+	for i, line := range readCaptureLines(id) {
+		if re.MatchString(line) {
+			return fmt.Sprintf("%q on line %d", re.String(), i+1)
+		}
+	}
+	return ""
+}